@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clipDuration int
+	clipName     string
+	clipPostRoll int
+)
+
+var clipCmd = &cobra.Command{
+	Use:   "clip",
+	Short: "Save a clip from the running clip-mode recording",
+	Run: func(cmd *cobra.Command, args []string) {
+		clients := connectTargets()
+		defer clients[0].Close()
+
+		failed := false
+		for _, client := range clients {
+			path, err := client.SaveClipWithPostRoll(time.Duration(clipDuration)*time.Second, time.Duration(clipPostRoll)*time.Second, clipName)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			fmt.Println(path)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clipCmd)
+
+	clipCmd.Flags().IntVarP(&clipDuration, "duration", "d", 0, "Clip length in seconds (default: the recorder's buffer duration)")
+	clipCmd.Flags().StringVarP(&clipName, "name", "n", "", "File name for the clip, without extension")
+	clipCmd.Flags().IntVarP(&clipPostRoll, "post-roll", "P", 0, "Also include this many seconds after the request")
+	addTargetFlags(clipCmd, true)
+}
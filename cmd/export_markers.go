@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"simon-weij/wayland-recorder/lib"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportBefore time.Duration
+	exportAfter  time.Duration
+	exportList   bool
+)
+
+var exportMarkersCmd = &cobra.Command{
+	Use:   "export-markers <recording>",
+	Short: "Cut clips around the markers of a finished recording",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		recording := args[0]
+		markers, err := lib.LoadMarkers(recording)
+		fatalIfError(err)
+
+		if len(markers) == 0 {
+			fmt.Println("No markers in", lib.MarkersPath(recording))
+			return
+		}
+		if exportList {
+			for _, marker := range markers {
+				fmt.Println(marker)
+			}
+			return
+		}
+
+		clips, err := lib.ExportMarkerClips(recording, markers, exportBefore, exportAfter)
+		for _, clip := range clips {
+			fmt.Println(clip)
+		}
+		fatalIfError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportMarkersCmd)
+
+	exportMarkersCmd.Flags().DurationVarP(&exportBefore, "before", "b", 15*time.Second, "How much to include before each marker")
+	exportMarkersCmd.Flags().DurationVarP(&exportAfter, "after", "a", 15*time.Second, "How much to include after each marker")
+	exportMarkersCmd.Flags().BoolVarP(&exportList, "list", "l", false, "Only print the markers")
+}
@@ -0,0 +1,37 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"simon-weij/wayland-recorder/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	targetInstance string
+	targetAll      bool
+)
+
+func addTargetFlags(command *cobra.Command, allowAll bool) {
+	command.Flags().StringVarP(&targetInstance, "instance", "i", "", "Recorder instance to control (default: the only running one)")
+	if allowAll {
+		command.Flags().BoolVar(&targetAll, "all", false, "Apply to every running recorder instance")
+		command.MarkFlagsMutuallyExclusive("instance", "all")
+	}
+}
+
+func recorderTarget() lib.RecorderTarget {
+	if targetInstance != "" {
+		fatalIfError(lib.ValidateInstanceName(targetInstance))
+	}
+	return lib.RecorderTarget{Instance: targetInstance, All: targetAll}
+}
+
+func connectTargets() []*lib.RecorderClient {
+	clients, err := lib.ConnectRecorders(recorderTarget())
+	fatalIfError(err)
+	return clients
+}
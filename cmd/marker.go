@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var markerCmd = &cobra.Command{
+	Use:   "marker [label]",
+	Short: "Add a marker to the running recording",
+	Long: `Add a timestamped marker to the running recording.
+
+Markers are written to a .markers.json file next to the recording and, when
+the recording stops, as chapters in the file itself. Use 'export-markers' to
+cut clips around them afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clients := connectTargets()
+		defer clients[0].Close()
+
+		label := strings.Join(args, " ")
+		failed := false
+		for _, client := range clients {
+			marker, err := client.AddMarker(label)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			fmt.Println(marker)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(markerCmd)
+
+	addTargetFlags(markerCmd, true)
+}
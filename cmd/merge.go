@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"path/filepath"
+	"simon-weij/wayland-recorder/lib"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var mergeOutput string
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <manifest>",
+	Short: "Join split recording files listed in an ffconcat manifest",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manifest := args[0]
+		output := mergeOutput
+		if output == "" {
+			output = defaultMergeOutput(manifest)
+		}
+		fatalIfError(lib.MergeManifest(manifest, output))
+	},
+}
+
+func defaultMergeOutput(manifest string) string {
+	files, err := lib.ReadConcatManifest(manifest)
+	ext := ".mp4"
+	if err == nil && len(files) > 0 {
+		ext = filepath.Ext(files[0])
+	}
+	return strings.TrimSuffix(manifest, filepath.Ext(manifest)) + ext
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringVarP(&mergeOutput, "output", "o", "", "Output file path (default: manifest name with the parts' extension)")
+}
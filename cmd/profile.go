@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"simon-weij/wayland-recorder/lib"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func loadProfile(name string) (map[string]any, error) {
+	settings, err := lib.LoadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings for profile %q: %w", name, err)
+	}
+	return settings.Profile(name)
+}
+
+func applyProfile(cmd *cobra.Command, name string) error {
+	profile, err := loadProfile(name)
+	if err != nil {
+		return err
+	}
+
+	for _, flagName := range sortedKeys(profile) {
+		flag := cmd.Flags().Lookup(flagName)
+		if flag == nil {
+			return fmt.Errorf("profile %q: unknown option %q", name, flagName)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(flagName, profileValue(profile[flagName])); err != nil {
+			return fmt.Errorf("profile %q: %s: %w", name, flagName, err)
+		}
+	}
+	return nil
+}
+
+func profileArgs(cmd *cobra.Command, name string) ([]string, error) {
+	profile, err := loadProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, flagName := range sortedKeys(profile) {
+		if cmd.Flags().Lookup(flagName) == nil {
+			return nil, fmt.Errorf("profile %q: unknown option %q", name, flagName)
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", flagName, profileValue(profile[flagName])))
+	}
+	return args, nil
+}
+
+func profileValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	case []any:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = profileValue(item)
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func sortedKeys(profile map[string]any) []string {
+	keys := make([]string, 0, len(profile))
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
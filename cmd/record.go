@@ -5,6 +5,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -26,11 +27,35 @@ var (
 	quality         int
 	audioMonitor    bool
 	audioMic        bool
+	micNoiseSupp    string
+	micGate         float64
+	pushToTalk      bool
 	clipMode        bool
 	bufferDuration  int
 	segmentDuration int
 	tempDir         string
 	noNotifications bool
+	maxDuration     time.Duration
+	maxSizeStr      string
+	rollover        bool
+	splitEvery      string
+	splitManifest   bool
+	crashSafe       bool
+	instance        string
+	profileName     string
+	daemon          bool
+	logFile         string
+	withShortcuts   bool
+	clipPresets     []time.Duration
+	memoryBuffer    bool
+	memoryLimitStr  string
+	bufferMaxStr    string
+	minFreeStr      string
+	onLowDisk       string
+	orphanRetention time.Duration
+	outputTemplate  string
+	clipTemplate    string
+	clipJobs        int
 )
 
 const (
@@ -77,16 +102,73 @@ func fatalIfError(err error) {
 	}
 }
 
+func exitOnLimit(err error) {
+	var limitErr *lib.LimitError
+	if errors.As(err, &limitErr) {
+		fmt.Println(limitErr)
+		os.Exit(limitErr.ExitCode())
+	}
+	fatalIfError(err)
+}
+
 var recordCmd = &cobra.Command{
 	Use:   "record",
 	Short: "Start recording",
 	Run: func(cmd *cobra.Command, args []string) {
+		if profileName != "" {
+			fatalIfError(applyProfile(cmd, profileName))
+		}
+		fatalIfError(lib.ValidateInstanceName(instance))
+
+		if daemon && !lib.Daemonized() {
+			if logFile == "" {
+				logFile = lib.DefaultLogPath(instance)
+			}
+			pid, err := lib.Daemonize(logFile)
+			fatalIfError(err)
+			fmt.Printf("Recorder %s running in the background (PID %d)\n", instance, pid)
+			fmt.Printf("Log: %s\n", logFile)
+			return
+		}
+
 		sourceType, err := parseSourceType(sourceTypeStr)
 		fatalIfError(err)
 
 		cursorMode, err := parseCursorMode(cursorModeStr)
 		fatalIfError(err)
 
+		fatalIfError(lib.ValidateNoiseSuppression(micNoiseSupp))
+
+		maxSize, err := lib.ParseSize(maxSizeStr)
+		fatalIfError(err)
+
+		memoryLimit, err := lib.ParseSize(memoryLimitStr)
+		fatalIfError(err)
+		if memoryBuffer && !clipMode {
+			fmt.Println("Warning: --memory-buffer only applies in clip mode")
+		}
+
+		bufferMaxSize, err := lib.ParseSize(bufferMaxStr)
+		fatalIfError(err)
+		minFreeSpace, err := lib.ParseSize(minFreeStr)
+		fatalIfError(err)
+		fatalIfError(lib.ValidateLowDiskAction(onLowDisk))
+		fatalIfError(lib.ValidateClipPresets(clipPresets))
+		fatalIfError(lib.ValidateTemplate(outputTemplate))
+		fatalIfError(lib.ValidateTemplate(clipTemplate))
+
+		splitDuration, splitSize, err := lib.ParseSplitEvery(splitEvery)
+		fatalIfError(err)
+		if clipMode && splitEvery != "" {
+			fmt.Println("Warning: --split-every is ignored in clip mode")
+		}
+		if crashSafe && (clipMode || splitEvery != "") {
+			fmt.Println("Warning: --crash-safe only applies to single-file recordings")
+		}
+		if pushToTalk && !audioMic {
+			fmt.Println("Warning: --push-to-talk has no effect without --audio-mic")
+		}
+
 		conn, session, err := lib.CreateSession()
 		fatalIfError(err)
 		defer conn.Close()
@@ -98,54 +180,127 @@ var recordCmd = &cobra.Command{
 
 		fmt.Printf("Recording stream %d\n", streams[0].NodeID)
 
+		windowTitle := lib.ActiveWindowTitle()
+		if windowTitle == "" {
+			windowTitle = strings.ToLower(sourceTypeStr)
+		}
+		outputPath = recordingPath(cmd, windowTitle)
+
 		captureOpts := lib.CaptureOptions{
-			OutputPath:      outputPath,
-			Codec:           codec,
-			Container:       container,
-			EncoderSpeed:    encoderSpeed,
-			Quality:         quality,
-			AudioMonitor:    audioMonitor,
-			AudioMic:        audioMic,
-			ClipMode:        clipMode,
-			BufferDuration:  bufferDuration,
-			SegmentDuration: segmentDuration,
-			TempDir:         tempDir,
-			Notifications:   !noNotifications,
+			OutputPath:          outputPath,
+			Codec:               codec,
+			Container:           container,
+			EncoderSpeed:        encoderSpeed,
+			Quality:             quality,
+			AudioMonitor:        audioMonitor,
+			AudioMic:            audioMic,
+			MicNoiseSuppression: micNoiseSupp,
+			MicGateThreshold:    micGate,
+			PushToTalk:          pushToTalk,
+			ClipMode:            clipMode,
+			BufferDuration:      bufferDuration,
+			SegmentDuration:     segmentDuration,
+			TempDir:             tempDir,
+			Notifications:       !noNotifications,
+			MaxDuration:         maxDuration,
+			MaxSize:             maxSize,
+			Rollover:            rollover,
+			SplitDuration:       splitDuration,
+			SplitSize:           splitSize,
+			SplitManifest:       splitManifest,
+			CrashSafe:           crashSafe,
+			Instance:            instance,
+			ClipPresets:         clipPresets,
+			MemoryBuffer:        memoryBuffer,
+			MemoryLimit:         memoryLimit,
+			BufferMaxSize:       bufferMaxSize,
+			MinFreeSpace:        minFreeSpace,
+			OnLowDisk:           onLowDisk,
+			OrphanRetention:     orphanRetention,
+			ClipTemplate:        clipTemplate,
+			WindowTitle:         windowTitle,
+			Profile:             profileName,
+			ClipJobs:            clipJobs,
 		}
 
-		fatalIfError(lib.Capture(streams[0].NodeID, captureOpts))
+		if withShortcuts {
+			startShortcutListener(shortcutCmd, instance)
+		}
+
+		exitOnLimit(lib.Capture(streams[0].NodeID, captureOpts))
 	},
 }
 
+func recordingPath(cmd *cobra.Command, windowTitle string) string {
+	if !cmd.Flags().Changed("output") {
+		values := lib.TemplateValues{Counter: 1, Instance: instance, Window: windowTitle, Profile: profileName}
+		return lib.TemplatePath(defaultRecordingsDir(), outputTemplate, container, &values)
+	}
+
+	if _, err := os.Stat(outputPath); err == nil {
+		unique := lib.UniquePath(outputPath)
+		fmt.Printf("%s already exists, recording to %s instead\n", outputPath, unique)
+		return unique
+	}
+	return outputPath
+}
+
 type recordDefaults struct {
-	cursorMode      string
-	codec           string
-	container       string
-	encoderSpeed    int
-	quality         int
-	audioMonitor    bool
-	audioMic        bool
-	bufferDuration  int
-	segmentDuration int
-	tempDir         string
-	output          string
-	notifications   bool
+	cursorMode          string
+	codec               string
+	container           string
+	encoderSpeed        int
+	quality             int
+	audioMonitor        bool
+	audioMic            bool
+	micNoiseSuppression string
+	micGateThreshold    float64
+	pushToTalk          bool
+	bufferDuration      int
+	segmentDuration     int
+	tempDir             string
+	notifications       bool
+	crashSafe           bool
+	clipPresets         []time.Duration
+	memoryBuffer        bool
+	memoryLimit         string
+	bufferMaxSize       string
+	minFreeSpace        string
+	onLowDisk           string
+	orphanRetention     time.Duration
+	outputTemplate      string
+	clipTemplate        string
+	clipJobs            int
+}
+
+func defaultRecordingsDir() string {
+	settings, err := lib.LoadSettings()
+	if err == nil && settings != nil && settings.OutputPath != "" {
+		return settings.OutputPath
+	}
+	return filepath.Join(os.Getenv("HOME"), "Videos", "recordings")
 }
 
 func getRecordDefaults() recordDefaults {
 	defaults := recordDefaults{
-		cursorMode:      "embedded",
-		codec:           "h264",
-		container:       "mp4",
-		encoderSpeed:    6,
-		quality:         5000000,
-		audioMonitor:    true,
-		audioMic:        true,
-		bufferDuration:  30,
-		segmentDuration: 5,
-		tempDir:         "",
-		output:          filepath.Join(os.Getenv("HOME"), "Videos", "recordings", "recording-"+time.Now().Format("2006-01-02-15-04-05")+".mp4"),
-		notifications:   true,
+		cursorMode:          "embedded",
+		codec:               "h264",
+		container:           "mp4",
+		encoderSpeed:        6,
+		quality:             5000000,
+		audioMonitor:        true,
+		audioMic:            true,
+		micNoiseSuppression: "off",
+		bufferDuration:      30,
+		segmentDuration:     5,
+		tempDir:             "",
+		notifications:       true,
+		minFreeSpace:        "1G",
+		onLowDisk:           lib.LowDiskWarn,
+		orphanRetention:     lib.DefaultOrphanRetention,
+		outputTemplate:      lib.DefaultRecordingTemplate,
+		clipTemplate:        lib.DefaultClipTemplate,
+		clipJobs:            lib.DefaultClipJobs,
 	}
 
 	settings, err := lib.LoadSettings()
@@ -168,6 +323,12 @@ func getRecordDefaults() recordDefaults {
 	if settings.Quality != 0 {
 		defaults.quality = settings.Quality
 	}
+	if settings.MicNoiseSuppression != "" {
+		defaults.micNoiseSuppression = settings.MicNoiseSuppression
+	}
+	if settings.MicGateThreshold != 0 {
+		defaults.micGateThreshold = settings.MicGateThreshold
+	}
 	if settings.BufferDuration != 0 {
 		defaults.bufferDuration = settings.BufferDuration
 	}
@@ -180,10 +341,32 @@ func getRecordDefaults() recordDefaults {
 
 	defaults.audioMonitor = settings.AudioMonitor
 	defaults.audioMic = settings.AudioMic
+	defaults.pushToTalk = settings.PushToTalk
 	defaults.notifications = settings.Notifications
-
-	if settings.OutputPath != "" {
-		defaults.output = filepath.Join(settings.OutputPath, "recording-"+time.Now().Format("2006-01-02-15-04-05")+"."+settings.Container)
+	defaults.crashSafe = settings.CrashSafe
+	defaults.memoryBuffer = settings.MemoryBuffer
+	defaults.memoryLimit = settings.MemoryLimit
+	defaults.bufferMaxSize = settings.BufferMaxSize
+	if settings.MinFreeSpace != "" {
+		defaults.minFreeSpace = settings.MinFreeSpace
+	}
+	if settings.OnLowDisk != "" {
+		defaults.onLowDisk = settings.OnLowDisk
+	}
+	if settings.ClipJobs != 0 {
+		defaults.clipJobs = settings.ClipJobs
+	}
+	if settings.OutputTemplate != "" {
+		defaults.outputTemplate = settings.OutputTemplate
+	}
+	if settings.ClipTemplate != "" {
+		defaults.clipTemplate = settings.ClipTemplate
+	}
+	if retention, err := time.ParseDuration(settings.OrphanRetention); err == nil {
+		defaults.orphanRetention = retention
+	}
+	for _, seconds := range settings.ClipPresets {
+		defaults.clipPresets = append(defaults.clipPresets, time.Duration(seconds*float64(time.Second)))
 	}
 
 	return defaults
@@ -195,16 +378,40 @@ func init() {
 
 	recordCmd.Flags().StringVarP(&sourceTypeStr, "source", "s", "monitor", "Source type: monitor, window, or both")
 	recordCmd.Flags().StringVarP(&cursorModeStr, "cursor", "c", defaults.cursorMode, "Cursor mode: hidden, embedded, or metadata")
-	recordCmd.Flags().StringVarP(&outputPath, "output", "o", defaults.output, "Output file path")
+	recordCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path (default: --output-template in the recordings directory)")
+	recordCmd.Flags().StringVar(&outputTemplate, "output-template", defaults.outputTemplate, "File name template used when --output is not given, e.g. '{date}/{instance}-{time}'")
+	recordCmd.Flags().StringVar(&clipTemplate, "clip-template", defaults.clipTemplate, "File name template for clips ("+strings.Join(lib.TemplatePlaceholders(), ", ")+")")
 	recordCmd.Flags().StringVar(&codec, "codec", defaults.codec, "Video codec: vp8, vp9, h264, x264")
 	recordCmd.Flags().StringVar(&container, "container", defaults.container, "Container format: webm, mp4, mkv")
 	recordCmd.Flags().IntVar(&encoderSpeed, "speed", defaults.encoderSpeed, "Encoder speed/deadline (higher = better quality, slower)")
 	recordCmd.Flags().IntVar(&quality, "quality", defaults.quality, "Target bitrate in bits/second (0=codec default)")
 	recordCmd.Flags().BoolVar(&audioMonitor, "audio-monitor", defaults.audioMonitor, "Record system audio (monitor)")
 	recordCmd.Flags().BoolVar(&audioMic, "audio-mic", defaults.audioMic, "Record microphone audio")
+	recordCmd.Flags().StringVar(&micNoiseSupp, "mic-noise-suppression", defaults.micNoiseSuppression, "Microphone noise suppression: off, auto, rnnoise, or webrtc")
+	recordCmd.Flags().Float64Var(&micGate, "mic-gate-threshold", defaults.micGateThreshold, "Microphone noise gate threshold from 0.0 to 1.0 (0=disabled)")
+	recordCmd.Flags().BoolVar(&pushToTalk, "push-to-talk", defaults.pushToTalk, "Keep the microphone muted unless the push-to-talk shortcut is held")
 	recordCmd.Flags().BoolVar(&clipMode, "clip-mode", false, "Enable clip mode (buffer recording and save clips on signal)")
 	recordCmd.Flags().IntVar(&bufferDuration, "buffer-duration", defaults.bufferDuration, "Duration in seconds to keep buffered for clipping")
 	recordCmd.Flags().IntVar(&segmentDuration, "segment-duration", defaults.segmentDuration, "Duration in seconds for each segment file")
+	recordCmd.Flags().DurationSliceVar(&clipPresets, "clip-presets", defaults.clipPresets, "Clip lengths saved by realtime signals 35, 36, ... e.g. 10s,2m")
+	recordCmd.Flags().BoolVar(&memoryBuffer, "memory-buffer", defaults.memoryBuffer, "Keep the clip buffer in memory and only write to disk when a clip is saved")
+	recordCmd.Flags().StringVar(&memoryLimitStr, "memory-limit", defaults.memoryLimit, "Cap the memory used by --memory-buffer, e.g. 256M (0=no cap)")
+	recordCmd.Flags().StringVar(&bufferMaxStr, "buffer-max-size", defaults.bufferMaxSize, "Cap the disk space used by clip segments, e.g. 2G (0=no cap)")
+	recordCmd.Flags().StringVar(&minFreeStr, "min-free-space", defaults.minFreeSpace, "Warn when the output or temp directory has less free space than this (0=disabled)")
+	recordCmd.Flags().StringVar(&onLowDisk, "on-low-disk", defaults.onLowDisk, "What to do when free space runs low: warn or pause")
+	recordCmd.Flags().DurationVar(&orphanRetention, "orphan-retention", defaults.orphanRetention, "Delete clip buffers left by crashed recorders after this long (0=keep them)")
+	recordCmd.Flags().IntVar(&clipJobs, "clip-jobs", defaults.clipJobs, "How many clips may be encoded at the same time")
 	recordCmd.Flags().StringVar(&tempDir, "temp-dir", defaults.tempDir, "Temporary directory for segments (default: system temp)")
+	recordCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop recording after this duration, e.g. 90m or 2h (0=unlimited)")
+	recordCmd.Flags().StringVar(&maxSizeStr, "max-size", "", "Stop recording once the output reaches this size, e.g. 500M or 4G")
+	recordCmd.Flags().BoolVar(&rollover, "rollover", false, "Continue in a new numbered file instead of stopping when a limit is reached")
+	recordCmd.Flags().StringVar(&splitEvery, "split-every", "", "Split the recording into numbered files every duration or size, e.g. 15m, 1h or 2GB (sizes need a B suffix)")
+	recordCmd.Flags().BoolVar(&splitManifest, "split-manifest", false, "Write an ffconcat manifest listing the split files (join with 'merge')")
+	recordCmd.Flags().BoolVar(&crashSafe, "crash-safe", defaults.crashSafe, "Write a fragmented file while recording and remux it on clean stop")
+	recordCmd.Flags().StringVarP(&instance, "instance", "i", lib.DefaultInstance, "Instance name (letters, digits and '-'), so several recorders can run side by side")
+	recordCmd.Flags().StringVarP(&profileName, "profile", "p", "", "Apply a named profile from settings.json (explicit flags still win)")
+	recordCmd.Flags().BoolVar(&daemon, "daemon", false, "Detach and keep recording in the background (notifies systemd when run as a service)")
+	recordCmd.Flags().StringVar(&logFile, "log-file", "", "Log file for --daemon outside systemd (default: ~/.local/state/wayland-recorder/<instance>.log)")
+	recordCmd.Flags().BoolVar(&withShortcuts, "shortcuts", false, "Listen for the global shortcuts from settings.json inside this recorder")
 	recordCmd.Flags().BoolVar(&noNotifications, "no-notifications", !defaults.notifications, "Disable notifications")
 }
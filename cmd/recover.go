@@ -0,0 +1,127 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"simon-weij/wayland-recorder/lib"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	recoverDir    string
+	recoverKeep   bool
+	recoverMinAge time.Duration
+	recoverClips  bool
+	recoverTemp   string
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover [file...]",
+	Short: "Repair or remux recordings left behind by crashed sessions",
+	Long: `Repair or remux recordings left behind by crashed sessions.
+
+With --clips, the clip buffers that crashed clip mode recorders left in the
+temp directory are saved as clips in the recordings directory instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if recoverClips {
+			recoverClipBuffers()
+			return
+		}
+
+		candidates := recoveryCandidates(args)
+		if len(candidates) == 0 {
+			fmt.Println("Nothing to recover")
+			return
+		}
+
+		failed := 0
+		for _, candidate := range candidates {
+			fmt.Printf("Recovering %d file(s) into: %s\n", len(candidate.Inputs), candidate.Output)
+			if err := lib.Recover(candidate, recoverKeep); err != nil {
+				fmt.Printf("Failed to recover %s: %v\n", candidate.Output, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			fatalIfError(fmt.Errorf("%d of %d recoveries failed", failed, len(candidates)))
+		}
+	},
+}
+
+func recoveryCandidates(files []string) []lib.RecoveryCandidate {
+	if len(files) > 0 {
+		candidates := make([]lib.RecoveryCandidate, 0, len(files))
+		for _, file := range files {
+			candidates = append(candidates, lib.CandidateForFile(file))
+		}
+		return candidates
+	}
+
+	dir := recoverDir
+	if dir == "" {
+		dir = defaultRecordingsDir()
+	}
+
+	candidates, err := lib.FindRecoveryCandidates(dir, recoverMinAge)
+	fatalIfError(err)
+	return candidates
+}
+
+func recoverClipBuffers() {
+	tempDir := recoverTemp
+	if settings, err := lib.LoadSettings(); tempDir == "" && err == nil {
+		tempDir = settings.TempDir
+	}
+
+	orphans, err := lib.FindOrphanedBuffers(tempDir)
+	fatalIfError(err)
+	if len(orphans) == 0 {
+		fmt.Println("No clip buffers to recover")
+		return
+	}
+
+	dir := recoverDir
+	if dir == "" {
+		dir = defaultRecordingsDir()
+	}
+	fatalIfError(os.MkdirAll(dir, 0755))
+
+	failed := 0
+	for _, orphan := range orphans {
+		if len(orphan.Segments) == 0 {
+			if !recoverKeep {
+				fmt.Printf("Removing empty clip buffer: %s\n", orphan.Dir)
+				os.RemoveAll(orphan.Dir)
+			}
+			continue
+		}
+
+		output := orphan.ClipPath(dir)
+		fmt.Printf("Recovering %d segment(s) from %s (instance %s, PID %d) into: %s\n", len(orphan.Segments), orphan.Dir, orphan.Instance, orphan.PID, output)
+		if err := lib.SalvageOrphan(orphan, output, recoverKeep); err != nil {
+			fmt.Printf("Failed to recover %s: %v\n", orphan.Dir, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fatalIfError(fmt.Errorf("%d of %d recoveries failed", failed, len(orphans)))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+
+	recoverCmd.Flags().StringVar(&recoverDir, "dir", "", "Directory to scan for leftover recordings (default: recordings directory)")
+	recoverCmd.Flags().BoolVar(&recoverKeep, "keep", false, "Keep the original files after recovery")
+	recoverCmd.Flags().BoolVar(&recoverClips, "clips", false, "Save clip buffers left by crashed clip mode recorders as clips")
+	recoverCmd.Flags().StringVar(&recoverTemp, "temp-dir", "", "Temporary directory to scan with --clips (default: tempDir setting or system temp)")
+	recoverCmd.Flags().DurationVar(&recoverMinAge, "min-age", time.Minute, "Skip files modified more recently than this, as they may still be recording")
+}
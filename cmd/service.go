@@ -0,0 +1,87 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"simon-weij/wayland-recorder/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceInstance string
+	serviceProfile  string
+	serviceNoSocket bool
+	serviceNoDBus   bool
+	serviceEnable   bool
+	serviceDryRun   bool
+)
+
+var installServiceCmd = &cobra.Command{
+	Use:   "install-service [-- record flags...]",
+	Short: "Install a systemd user unit that runs the recorder in the background",
+	Long: `Install a systemd user unit that runs 'record --daemon' from login.
+
+The chosen profile is expanded into explicit record flags in the unit, and any
+arguments after -- are passed to record as well. Unless disabled, a socket unit
+and a D-Bus service file are installed too, so the recorder is started on demand
+by the control socket or by 'wayland-recorder clip'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fatalIfError(lib.ValidateInstanceName(serviceInstance))
+
+		var recordArgs []string
+		if serviceProfile != "" {
+			expanded, err := profileArgs(recordCmd, serviceProfile)
+			fatalIfError(err)
+			recordArgs = append(recordArgs, expanded...)
+		}
+		recordArgs = append(recordArgs, args...)
+
+		executable, err := os.Executable()
+		fatalIfError(err)
+
+		files, err := lib.BuildServiceFiles(lib.ServiceConfig{
+			Executable: executable,
+			Instance:   serviceInstance,
+			Args:       recordArgs,
+			Socket:     !serviceNoSocket,
+			DBus:       !serviceNoDBus,
+		})
+		fatalIfError(err)
+
+		if serviceDryRun {
+			for _, file := range files {
+				fmt.Printf("# %s\n%s\n", file.Path, file.Content)
+			}
+			return
+		}
+
+		fatalIfError(lib.InstallServiceFiles(files))
+
+		unit := lib.ServiceUnitName(serviceInstance)
+		if serviceEnable {
+			fatalIfError(lib.EnableService(serviceInstance, !serviceNoSocket))
+			fmt.Printf("Enabled and started %s\n", unit)
+			return
+		}
+
+		fmt.Println("Run the following to start it now and at every login:")
+		fmt.Println("  systemctl --user daemon-reload")
+		fmt.Printf("  systemctl --user enable --now %s.service\n", unit)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(installServiceCmd)
+
+	installServiceCmd.Flags().StringVarP(&serviceInstance, "instance", "i", lib.DefaultInstance, "Instance name for the service")
+	installServiceCmd.Flags().StringVarP(&serviceProfile, "profile", "p", "", "Settings profile to bake into the unit")
+	installServiceCmd.Flags().BoolVar(&serviceNoSocket, "no-socket", false, "Do not install a socket activation unit")
+	installServiceCmd.Flags().BoolVar(&serviceNoDBus, "no-dbus", false, "Do not install a D-Bus activation file")
+	installServiceCmd.Flags().BoolVar(&serviceEnable, "enable", false, "Reload systemd and enable the units right away")
+	installServiceCmd.Flags().BoolVar(&serviceDryRun, "dry-run", false, "Print the generated files instead of writing them")
+}
@@ -7,41 +7,170 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 	"simon-weij/wayland-recorder/lib"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	shortcutKey string
+	shortcutKey          string
+	pushToTalkKey        string
+	pauseKey             string
+	shortcutBinds        map[string]string
+	shortcutClipDuration int
+	shortcutProfile      string
+	shortcutNoNotify     bool
+	shortcutList         bool
+	shortcutHoldPreRoll  float64
 )
 
 var shortcutCmd = &cobra.Command{
 	Use:   "shortcut",
-	Short: "Register a global shortcut to start recording",
+	Short: "Register global shortcuts to control recording",
+	Long: fmt.Sprintf(`Register global shortcuts to control recording.
+
+Shortcuts are read from the "shortcuts" object in settings.json, mapping an
+action to a key combination, and can be overridden with --bind action=key.
+Available actions: %s
+
+Extra clip shortcuts with their own length go in "clipShortcuts", e.g.
+[{"name": "quick", "key": "alt+1", "duration": 10}].`, strings.Join(lib.ShortcutActionIDs(), ", ")),
 	Run: func(cmd *cobra.Command, args []string) {
-		key := getShortcutKey()
-		fatalIfError(lib.RegisterShortcut(key, "Start screen recording"))
+		if shortcutList {
+			listShortcuts()
+			return
+		}
+
+		options := shortcutOptions(cmd, recorderTarget())
+		if len(options.Bindings) == 0 && len(options.ClipShortcuts) == 0 {
+			log.Fatal("No shortcut specified. Use --key or --bind, or set 'shortcuts' in settings.json")
+		}
+		fatalIfError(lib.RegisterShortcuts(options))
 	},
 }
 
-func getShortcutKey() string {
-	if shortcutKey != "" {
-		return shortcutKey
+func shortcutOptions(cmd *cobra.Command, target lib.RecorderTarget) lib.ShortcutOptions {
+	settings, err := lib.LoadSettings()
+	notifications := true
+	if err != nil {
+		settings = &lib.Settings{}
+	} else {
+		notifications = settings.Notifications
+	}
+
+	clipDuration := settings.ClipDuration
+	if cmd.Flags().Changed("clip-duration") {
+		clipDuration = shortcutClipDuration
 	}
 
-	settings, err := lib.LoadSettings()
-	if err == nil && settings != nil && settings.Hotkey != "" {
-		fmt.Printf("Using shortcut from settings: %s\n", settings.Hotkey)
-		return settings.Hotkey
+	holdPreRoll := settings.HoldPreRoll
+	if cmd.Flags().Changed("hold-pre-roll") {
+		holdPreRoll = shortcutHoldPreRoll
+	}
+
+	profile := settings.ShortcutProfile
+	if shortcutProfile != "" {
+		profile = shortcutProfile
+	}
+	if profile != "" {
+		_, err := settings.Profile(profile)
+		fatalIfError(err)
+	}
+
+	return lib.ShortcutOptions{
+		Bindings:      shortcutBindings(settings),
+		ClipShortcuts: settings.ClipShortcuts,
+		Target:        target,
+		ClipDuration:  time.Duration(clipDuration) * time.Second,
+		HoldPreRoll:   time.Duration(holdPreRoll * float64(time.Second)),
+		Profile:       profile,
+		Notifications: notifications && !shortcutNoNotify,
+	}
+}
+
+func startShortcutListener(cmd *cobra.Command, instance string) {
+	options := shortcutOptions(cmd, lib.RecorderTarget{Instance: instance})
+	if len(options.Bindings) == 0 && len(options.ClipShortcuts) == 0 {
+		fmt.Println("Warning: --shortcuts given but no shortcuts are configured in settings.json")
+		return
 	}
 
-	log.Fatal("No shortcut key specified. Use --key flag or set 'hotkey' in settings.json")
-	return ""
+	go func() {
+		if err := lib.RegisterShortcuts(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: shortcut listener unavailable: %v\n", err)
+		}
+	}()
+}
+
+func shortcutBindings(settings *lib.Settings) lib.ShortcutBindings {
+	bindings := lib.ShortcutBindings{}
+	for action, key := range map[string]string{
+		lib.ShortcutSaveClip:   settings.Hotkey,
+		lib.ShortcutPushToTalk: settings.PushToTalkKey,
+		lib.ShortcutPause:      settings.PauseHotkey,
+	} {
+		if key != "" {
+			bindings[action] = key
+		}
+	}
+	for action, key := range settings.Shortcuts {
+		fatalIfError(lib.ValidateShortcutAction(action))
+		bindings[action] = key
+	}
+
+	for action, key := range map[string]string{
+		lib.ShortcutSaveClip:   shortcutKey,
+		lib.ShortcutPushToTalk: pushToTalkKey,
+		lib.ShortcutPause:      pauseKey,
+	} {
+		if key != "" {
+			bindings[action] = key
+		}
+	}
+	for action, key := range shortcutBinds {
+		fatalIfError(lib.ValidateShortcutAction(action))
+		bindings[action] = key
+	}
+
+	for _, action := range lib.ShortcutActionIDs() {
+		if key, ok := bindings[action]; ok {
+			fmt.Printf("Using %s shortcut: %s\n", action, key)
+		}
+	}
+	return bindings
+}
+
+func listShortcuts() {
+	shortcuts, err := lib.ListShortcuts()
+	fatalIfError(err)
+
+	if len(shortcuts) == 0 {
+		fmt.Println("No shortcuts are bound")
+		return
+	}
+	for _, shortcut := range shortcuts {
+		trigger := shortcut.Trigger
+		if trigger == "" {
+			trigger = "(unassigned)"
+		}
+		fmt.Printf("%-16s %-24s %s\n", shortcut.ID, trigger, shortcut.Description)
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(shortcutCmd)
 
-	shortcutCmd.Flags().StringVarP(&shortcutKey, "key", "k", "", "Shortcut key combination (e.g., 'alt+z', 'ctrl+shift+r')")
+	shortcutCmd.Flags().StringVarP(&shortcutKey, "key", "k", "", "Shortcut to save a clip (e.g., 'alt+z', 'ctrl+shift+r')")
+	shortcutCmd.Flags().StringVar(&pushToTalkKey, "push-to-talk-key", "", "Shortcut to hold for push-to-talk (record with --push-to-talk)")
+	shortcutCmd.Flags().StringVar(&pauseKey, "pause-key", "", "Shortcut to pause or resume the running recording")
+	shortcutCmd.Flags().StringToStringVarP(&shortcutBinds, "bind", "b", nil, "Bind an action to a key, e.g. --bind save-long-clip=ctrl+alt+z (repeatable)")
+	shortcutCmd.Flags().IntVar(&shortcutClipDuration, "clip-duration", 0, "Seconds saved by the save-clip shortcut (0=the whole buffer)")
+	shortcutCmd.Flags().Float64Var(&shortcutHoldPreRoll, "hold-pre-roll", 0, "Seconds before the key press included by the hold-clip shortcut")
+	shortcutCmd.Flags().StringVarP(&shortcutProfile, "profile", "p", "", "Settings profile used when the start-stop shortcut launches a recording")
+	shortcutCmd.Flags().BoolVar(&shortcutNoNotify, "no-notifications", false, "Disable notifications")
+	shortcutCmd.Flags().BoolVarP(&shortcutList, "list", "l", false, "Print the currently bound shortcuts and exit")
+	addTargetFlags(shortcutCmd, true)
 }
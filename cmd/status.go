@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"simon-weij/wayland-recorder/lib"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the running recording",
+	Run: func(cmd *cobra.Command, args []string) {
+		clients := connectTargets()
+		defer clients[0].Close()
+
+		statuses := make([]lib.RecorderStatus, 0, len(clients))
+		for _, client := range clients {
+			status, err := client.Status()
+			fatalIfError(err)
+			statuses = append(statuses, status)
+		}
+
+		if statusJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if targetAll {
+				fatalIfError(encoder.Encode(statuses))
+			} else {
+				fatalIfError(encoder.Encode(statuses[0]))
+			}
+			return
+		}
+		for i, status := range statuses {
+			if i > 0 {
+				fmt.Println()
+			}
+			printStatus(status)
+		}
+	},
+}
+
+func printStatus(status lib.RecorderStatus) {
+	fmt.Printf("Instance:       %s\n", status.Instance)
+	fmt.Printf("State:          %s\n", status.State)
+	fmt.Printf("PID:            %d\n", status.PID)
+	fmt.Printf("Elapsed:        %s\n", formatSeconds(status.Elapsed))
+	if status.PausedTotal > 0 {
+		fmt.Printf("Paused:         %s\n", formatSeconds(status.PausedTotal))
+	}
+	fmt.Printf("Output:         %s\n", status.OutputPath)
+	if status.ClipMode {
+		fmt.Printf("Buffer:         %s of %s\n", formatSeconds(status.BufferFill), formatSeconds(status.BufferDuration))
+		if status.BufferLimit > 0 {
+			fmt.Printf("Buffer size:    %s of %s\n", lib.FormatSize(status.BufferBytes), lib.FormatSize(status.BufferLimit))
+		} else {
+			fmt.Printf("Buffer size:    %s\n", lib.FormatSize(status.BufferBytes))
+		}
+	}
+	for _, job := range status.ClipJobs {
+		line := fmt.Sprintf("%-16s%-8s %s (%s)", fmt.Sprintf("Clip job %d:", job.ID), job.State, job.Path, formatSeconds(job.Duration))
+		if job.Error != "" {
+			line += ": " + job.Error
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("Free space:     %s\n", lib.FormatSize(status.FreeSpace))
+	if status.DiskWarning != "" {
+		fmt.Printf("Disk warning:   low disk space, %s\n", status.DiskWarning)
+	}
+	fmt.Printf("Dropped frames: %d\n", status.DroppedFrames)
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the status as JSON (an array with --all)")
+	addTargetFlags(statusCmd, true)
+}
@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"simon-weij/wayland-recorder/lib"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var stopTimeout time.Duration
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running recording",
+	Run: func(cmd *cobra.Command, args []string) {
+		clients := connectTargets()
+		defer clients[0].Close()
+
+		statuses := make([]lib.RecorderStatus, len(clients))
+		for i, client := range clients {
+			status, err := client.Status()
+			fatalIfError(err)
+			statuses[i] = status
+			fatalIfError(client.Stop())
+		}
+
+		for i, client := range clients {
+			fatalIfError(client.WaitForExit(stopTimeout))
+			fmt.Printf("Stopped recording %s: %s\n", statuses[i].Instance, statuses[i].OutputPath)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+
+	stopCmd.Flags().DurationVar(&stopTimeout, "timeout", time.Minute, "How long to wait for the recording to finalize")
+	addTargetFlags(stopCmd, true)
+}
@@ -0,0 +1,172 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	gstInspectCommand = "gst-inspect-1.0"
+	micClientName     = "wayland-recorder-mic"
+	rnnoiseElement    = "ladspa-librnnoise-ladspa-so-noise-suppressor-mono"
+	webrtcdspElement  = "webrtcdsp"
+	gateElement       = "audiodynamic"
+)
+
+func buildMicBranch(opts CaptureOptions) []string {
+	branch := []string{
+		"pulsesrc", "device=@DEFAULT_SOURCE@", fmt.Sprintf("client-name=%s", micClientNameFor(opts.Instance)),
+	}
+	if opts.PushToTalk {
+		branch = append(branch, "mute=true")
+	}
+	branch = append(branch, "!", "queue", "!", "audioconvert")
+	branch = append(branch, buildNoiseSuppressionArgs(opts.MicNoiseSuppression)...)
+	branch = append(branch, buildNoiseGateArgs(opts.MicGateThreshold)...)
+	return branch
+}
+
+func buildNoiseSuppressionArgs(mode string) []string {
+	switch resolveNoiseSuppression(mode) {
+	case "rnnoise":
+		return []string{
+			"!", "audioresample", "!", "audio/x-raw,format=F32LE,rate=48000,channels=1",
+			"!", rnnoiseElement, "!", "audioconvert",
+		}
+	case "webrtc":
+		return []string{
+			"!", "audioresample", "!", "audio/x-raw,rate=48000",
+			"!", webrtcdspElement, "echo-cancel=false", "noise-suppression=true", "noise-suppression-level=high",
+			"!", "audioconvert",
+		}
+	default:
+		return nil
+	}
+}
+
+func resolveNoiseSuppression(mode string) string {
+	switch mode {
+	case "", "off":
+		return ""
+	case "rnnoise":
+		if gstElementAvailable(rnnoiseElement) {
+			return "rnnoise"
+		}
+	case "webrtc":
+		if gstElementAvailable(webrtcdspElement) {
+			return "webrtc"
+		}
+	case "auto":
+		if gstElementAvailable(rnnoiseElement) {
+			return "rnnoise"
+		}
+		if gstElementAvailable(webrtcdspElement) {
+			return "webrtc"
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: noise suppression %q is not available, recording mic unfiltered\n", mode)
+	return ""
+}
+
+func buildNoiseGateArgs(threshold float64) []string {
+	if threshold <= 0 {
+		return nil
+	}
+	if !gstElementAvailable(gateElement) {
+		fmt.Fprintf(os.Stderr, "Warning: %s element not found, noise gate disabled\n", gateElement)
+		return nil
+	}
+	return []string{
+		"!", gateElement, "mode=expander", "characteristics=hard-knee", "ratio=0.0",
+		fmt.Sprintf("threshold=%s", strconv.FormatFloat(threshold, 'f', -1, 64)),
+		"!", "audioconvert",
+	}
+}
+
+func ValidateNoiseSuppression(mode string) error {
+	switch mode {
+	case "", "off", "auto", "rnnoise", "webrtc":
+		return nil
+	default:
+		return fmt.Errorf("invalid noise suppression: %s (use: off, auto, rnnoise, or webrtc)", mode)
+	}
+}
+
+func gstElementAvailable(name string) bool {
+	return exec.Command(gstInspectCommand, "--exists", name).Run() == nil
+}
+
+type sourceOutput struct {
+	Index      int               `json:"index"`
+	Mute       bool              `json:"mute"`
+	Properties map[string]string `json:"properties"`
+}
+
+func micClientNameFor(instance string) string {
+	if instance == "" {
+		instance = DefaultInstance
+	}
+	return micClientName + "-" + instance
+}
+
+func micSourceOutputs(instance string) ([]sourceOutput, error) {
+	output, err := exec.Command("pactl", "--format=json", "list", "source-outputs").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source outputs: %w", err)
+	}
+
+	var outputs []sourceOutput
+	if err := json.Unmarshal(output, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse source outputs: %w", err)
+	}
+
+	var mics []sourceOutput
+	for _, out := range outputs {
+		if out.Properties["application.name"] == micClientNameFor(instance) {
+			mics = append(mics, out)
+		}
+	}
+	if len(mics) == 0 {
+		return nil, fmt.Errorf("no recording microphone stream found for instance %s", instance)
+	}
+	return mics, nil
+}
+
+func SetMicMuted(instance string, muted bool) error {
+	mics, err := micSourceOutputs(instance)
+	if err != nil {
+		return err
+	}
+	return setSourceOutputsMuted(mics, muted)
+}
+
+func ToggleMicMuted(instance string) (bool, error) {
+	mics, err := micSourceOutputs(instance)
+	if err != nil {
+		return false, err
+	}
+	muted := !mics[0].Mute
+	return muted, setSourceOutputsMuted(mics, muted)
+}
+
+func setSourceOutputsMuted(outputs []sourceOutput, muted bool) error {
+	state := "0"
+	if muted {
+		state = "1"
+	}
+
+	for _, out := range outputs {
+		if err := exec.Command("pactl", "set-source-output-mute", strconv.Itoa(out.Index), state).Run(); err != nil {
+			return fmt.Errorf("failed to set mute on source output %d: %w", out.Index, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type BoundShortcut struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Trigger     string `json:"trigger"`
+}
+
+type shortcutState struct {
+	Requested map[string]string `json:"requested"`
+	Bound     []BoundShortcut   `json:"bound"`
+}
+
+func listShortcuts(conn *dbus.Conn, portal dbus.BusObject, sessionPath dbus.ObjectPath) ([]BoundShortcut, error) {
+	options := map[string]dbus.Variant{
+		"handle_token": dbus.MakeVariant(generateToken()),
+	}
+
+	var requestPath dbus.ObjectPath
+	err := portal.Call("org.freedesktop.portal.GlobalShortcuts.ListShortcuts", 0, sessionPath, options).Store(&requestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shortcuts: %w", err)
+	}
+
+	response, err := waitForResponse(conn, requestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list response: %w", err)
+	}
+
+	shortcuts, ok := response["shortcuts"]
+	if !ok {
+		return nil, nil
+	}
+	return parseBoundShortcuts(shortcuts.Value()), nil
+}
+
+func parseBoundShortcuts(value interface{}) []BoundShortcut {
+	entries, ok := value.([][]interface{})
+	if !ok {
+		return nil
+	}
+
+	var shortcuts []BoundShortcut
+	for _, entry := range entries {
+		if len(entry) < 2 {
+			continue
+		}
+		id, ok := entry[0].(string)
+		if !ok {
+			continue
+		}
+		shortcut := BoundShortcut{ID: id}
+		if properties, ok := entry[1].(map[string]dbus.Variant); ok {
+			_ = properties["description"].Store(&shortcut.Description)
+			_ = properties["trigger_description"].Store(&shortcut.Trigger)
+		}
+		shortcuts = append(shortcuts, shortcut)
+	}
+	return shortcuts
+}
+
+func needsBind(wanted []shortcutStruct, bound []BoundShortcut, state shortcutState) bool {
+	if len(wanted) != len(bound) {
+		return true
+	}
+
+	boundIDs := make(map[string]bool, len(bound))
+	for _, shortcut := range bound {
+		boundIDs[shortcut.ID] = true
+	}
+
+	for _, shortcut := range wanted {
+		if !boundIDs[shortcut.ID] {
+			return true
+		}
+		trigger, _ := shortcut.Data["preferred_trigger"].Value().(string)
+		if state.Requested[shortcut.ID] != trigger {
+			return true
+		}
+	}
+	return false
+}
+
+func requestedTriggers(shortcuts []shortcutStruct) map[string]string {
+	requested := make(map[string]string, len(shortcuts))
+	for _, shortcut := range shortcuts {
+		requested[shortcut.ID], _ = shortcut.Data["preferred_trigger"].Value().(string)
+	}
+	return requested
+}
+
+func shortcutStatePath() string {
+	return filepath.Join(filepath.Dir(DefaultLogPath(DefaultInstance)), "shortcuts.json")
+}
+
+func loadShortcutState() shortcutState {
+	var state shortcutState
+	data, err := os.ReadFile(shortcutStatePath())
+	if err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func saveShortcutState(state shortcutState) {
+	path := shortcutStatePath()
+	if err := os.MkdirAll(filepath.Dir(path), defaultFilePermissions); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0644)
+}
+
+func printBoundShortcuts(shortcuts []BoundShortcut) {
+	for _, shortcut := range shortcuts {
+		trigger := shortcut.Trigger
+		if trigger == "" {
+			trigger = "(unassigned)"
+		}
+		fmt.Printf("  %-16s %-24s %s\n", shortcut.ID, trigger, shortcut.Description)
+	}
+}
+
+func handleShortcutsChanged(signal *dbus.Signal) {
+	if len(signal.Body) < 2 {
+		return
+	}
+
+	shortcuts := parseBoundShortcuts(signal.Body[1])
+	fmt.Println("Shortcuts changed in system settings:")
+	printBoundShortcuts(shortcuts)
+
+	state := loadShortcutState()
+	state.Bound = shortcuts
+	saveShortcutState(state)
+}
+
+func ListShortcuts() ([]BoundShortcut, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	portal := conn.Object(PortalServiceName, PortalObjectPath)
+	sessionPath, err := createShortcutSession(conn, portal)
+	if err != nil {
+		return nil, err
+	}
+
+	return listShortcuts(conn, portal, sessionPath)
+}
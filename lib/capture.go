@@ -7,15 +7,20 @@ package lib
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
+	// Kernel signal numbers, glibc and musl disagree on where RTMIN starts.
+	sigRTMin = 34
+	sigRTMax = 64
+
 	defaultFilePermissions = 0755
 	defaultSegmentDuration = 5
 	defaultBufferDuration  = 30
@@ -26,15 +31,21 @@ func Capture(nodeID uint32, opts CaptureOptions) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	baseTempDir := opts.TempDir
 	applyDefaults(&opts)
 
-	segmentManager := setupSegmentManager(&opts)
-	args, err := BuildGStreamerArgs(nodeID, opts)
-	if err != nil {
-		return fmt.Errorf("failed to build GStreamer arguments: %w", err)
+	if err := writePidFile(opts.Instance); err != nil {
+		return err
+	}
+	defer cleanupPidFile(opts.Instance)
+	if opts.ClipMode {
+		collectOrphanedBuffers(baseTempDir, opts.OrphanRetention)
 	}
 
-	return startRecording(args, opts, segmentManager)
+	buffer := setupClipBuffer(&opts)
+	recorder := NewRecorder(nodeID, opts, buffer)
+
+	return startRecording(recorder, opts, buffer)
 }
 
 func ensureOutputDirectory(outputPath string) error {
@@ -43,6 +54,12 @@ func ensureOutputDirectory(outputPath string) error {
 }
 
 func applyDefaults(opts *CaptureOptions) {
+	if opts.Instance == "" {
+		opts.Instance = DefaultInstance
+	}
+	if opts.ClipTemplate == "" {
+		opts.ClipTemplate = DefaultClipTemplate
+	}
 	if !opts.ClipMode {
 		return
 	}
@@ -55,9 +72,7 @@ func applyDefaults(opts *CaptureOptions) {
 		opts.Codec = "vp9"
 	}
 
-	if opts.TempDir == "" {
-		opts.TempDir = filepath.Join(os.TempDir(), fmt.Sprintf("wayland-recorder-%d", os.Getpid()))
-	}
+	opts.TempDir = instanceTempDir(opts.TempDir, opts.Instance)
 	if opts.SegmentDuration == 0 {
 		opts.SegmentDuration = defaultSegmentDuration
 	}
@@ -66,7 +81,17 @@ func applyDefaults(opts *CaptureOptions) {
 	}
 }
 
-func setupSegmentManager(opts *CaptureOptions) *SegmentManager {
+type clipBuffer interface {
+	Hold(since time.Time) func()
+	WaitForSegmentAfter(t time.Time, timeout time.Duration) bool
+	Export(from, until time.Time) ([]SegmentInfo, func(), error)
+	Fill() time.Duration
+	Size() int64
+	Limit() int64
+	Close()
+}
+
+func setupClipBuffer(opts *CaptureOptions) clipBuffer {
 	if !opts.ClipMode {
 		return nil
 	}
@@ -77,165 +102,440 @@ func setupSegmentManager(opts *CaptureOptions) *SegmentManager {
 	}
 
 	maxDuration := time.Duration(opts.BufferDuration+opts.SegmentDuration) * time.Second
-	return NewSegmentManager(maxDuration, opts.TempDir)
+	if opts.MemoryBuffer {
+		return NewMemoryRing(maxDuration, opts.MemoryLimit, opts.TempDir, opts.Container)
+	}
+	return NewSegmentManager(maxDuration, opts.BufferMaxSize, opts.TempDir)
 }
 
-func startRecording(args []string, opts CaptureOptions, segmentManager *SegmentManager) error {
-	cmd := exec.Command(gstreamerCommand, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start GStreamer: %w", err)
+func startRecording(recorder *Recorder, opts CaptureOptions, buffer clipBuffer) error {
+	control := newController()
+	control.subscribe(notifySystemd)
+	if service, err := startControlService(control, opts.Instance); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: D-Bus control unavailable: %v\n", err)
+	} else {
+		defer service.Close()
+	}
+	if socket, err := startControlSocket(control, opts.Instance); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: control socket unavailable: %v\n", err)
+	} else {
+		defer socket.Close()
 	}
 
-	if opts.ClipMode {
-		writePidFile()
+	if err := recorder.Start(); err != nil {
+		return err
 	}
 
 	printRecordingInfo(opts)
+	control.setState(StateRecording)
 
-	if opts.ClipMode && segmentManager != nil {
-		go MonitorSegments(opts.TempDir, opts.Container, segmentManager)
+	if manager, ok := buffer.(*SegmentManager); ok {
+		go WatchSegments(opts.TempDir, opts.Container, manager)
 	}
 
-	signals := setupSignalChannels(opts.ClipMode)
-	go func() {
-		signals.finished <- cmd.Wait()
-	}()
+	signals := setupSignalChannels(opts, control)
 
-	return processSignals(cmd, opts, segmentManager, signals)
+	return processSignals(recorder, opts, buffer, signals)
 }
 
 func printRecordingInfo(opts CaptureOptions) {
 	if opts.ClipMode {
 		fmt.Printf("Recording with %d second buffer...\n", opts.BufferDuration)
-		fmt.Printf("Segments stored in: %s\n", opts.TempDir)
-		fmt.Printf("Send SIGUSR1 to create a clip: kill -SIGUSR1 %d\n", os.Getpid())
+		if opts.MemoryBuffer {
+			fmt.Printf("Buffer kept in memory (limit: %s)\n", memoryLimitLabel(opts.MemoryLimit))
+		} else {
+			fmt.Printf("Segments stored in: %s\n", opts.TempDir)
+		}
+		fmt.Println("Run 'wayland-recorder clip' to create a clip")
+		for i, preset := range opts.ClipPresets {
+			fmt.Printf("Send signal %d for a %s clip: kill -%d %d\n", presetSignal(i), preset, presetSignal(i), os.Getpid())
+		}
+		fmt.Printf("Send SIGUSR2 to pause or resume: kill -SIGUSR2 %d\n", os.Getpid())
 		fmt.Printf("PID: %d\n", os.Getpid())
-		fmt.Println("Press Ctrl+C to stop recording")
+		fmt.Printf("Instance: %s\n", opts.Instance)
+		fmt.Printf("D-Bus control: %s\n", BusName(opts.Instance))
+		fmt.Printf("Control socket: %s\n", SocketPath(opts.Instance))
+		fmt.Println("Press Ctrl+C or run 'wayland-recorder stop' to stop recording")
 	} else {
 		fmt.Printf("Recording to: %s\n", opts.OutputPath)
-		fmt.Println("Press Ctrl+C to stop")
+		fmt.Printf("Send SIGUSR1 to add a marker: kill -SIGUSR1 %d\n", os.Getpid())
+		fmt.Printf("Send SIGUSR2 to pause or resume: kill -SIGUSR2 %d\n", os.Getpid())
+		fmt.Printf("Instance: %s\n", opts.Instance)
+		fmt.Printf("D-Bus control: %s\n", BusName(opts.Instance))
+		fmt.Printf("Control socket: %s\n", SocketPath(opts.Instance))
+		fmt.Println("Press Ctrl+C or run 'wayland-recorder stop' to stop")
 	}
 }
 
 type signalChannels struct {
 	interrupt chan os.Signal
 	clip      chan os.Signal
-	finished  chan error
+	preset    chan os.Signal
+	pause     chan os.Signal
+	control   *controller
 }
 
-func setupSignalChannels(clipMode bool) signalChannels {
+func setupSignalChannels(opts CaptureOptions, control *controller) signalChannels {
 	channels := signalChannels{
 		interrupt: make(chan os.Signal, 1),
 		clip:      make(chan os.Signal, 1),
-		finished:  make(chan error, 1),
+		preset:    make(chan os.Signal, 1),
+		pause:     make(chan os.Signal, 1),
+		control:   control,
 	}
-	
+
 	signal.Notify(channels.interrupt, os.Interrupt, syscall.SIGTERM)
-	if clipMode {
-		signal.Notify(channels.clip, syscall.SIGUSR1)
+	signal.Notify(channels.pause, syscall.SIGUSR2)
+	signal.Notify(channels.clip, syscall.SIGUSR1)
+	if opts.ClipMode {
+		for i := range opts.ClipPresets {
+			signal.Notify(channels.preset, presetSignal(i))
+		}
 	}
-	
+
 	return channels
 }
 
-func processSignals(cmd *exec.Cmd, opts CaptureOptions, segmentManager *SegmentManager, signals signalChannels) error {
-	clipCounter := 1
+func processSignals(recorder *Recorder, opts CaptureOptions, buffer clipBuffer, signals signalChannels) error {
+	limits, stopLimits := limitTicker(opts)
+	defer stopLimits()
+	health, stopHealth := diskTicker(opts)
+	defer stopHealth()
+
+	disk := &diskMonitor{opts: opts}
+	disk.check(recorder, signals.control)
+
+	control := signals.control
+	defer control.stop()
+	clips := newClipQueue(opts.ClipJobs)
 	for {
 		select {
 		case <-signals.clip:
-			handleClipRequest(opts, segmentManager, &clipCounter)
+			if !opts.ClipMode {
+				handleMarkerRequest(recorder, controlRequest{action: actionMarker}, control)
+				continue
+			}
+			handleClipRequest(opts, buffer, clips, controlRequest{action: actionClip}, control)
+
+		case sig := <-signals.preset:
+			request := controlRequest{action: actionClip, duration: presetDuration(sig, opts.ClipPresets)}
+			handleClipRequest(opts, buffer, clips, request, control)
+
+		case <-signals.pause:
+			handlePauseToggle(recorder, control)
+
+		case request := <-control.requests:
+			if request.action == actionStop {
+				request.respond(controlReply{})
+				return handleInterrupt(recorder, opts, buffer, control)
+			}
+			handleControlRequest(request, recorder, opts, buffer, clips, control)
 
 		case <-signals.interrupt:
-			return handleInterrupt(cmd, opts)
+			return handleInterrupt(recorder, opts, buffer, control)
+
+		case <-health:
+			disk.check(recorder, control)
+
+		case <-limits:
+			if err := handleLimits(recorder, opts, buffer, control); err != nil {
+				return err
+			}
+
+		case err := <-recorder.Done():
+			return handleFinished(recorder, err, buffer, control)
+		}
+	}
+}
 
-		case err := <-signals.finished:
-			return handleFinished(err)
+func presetSignal(index int) syscall.Signal {
+	return syscall.Signal(sigRTMin + 1 + index)
+}
+
+func ValidateClipPresets(presets []time.Duration) error {
+	if limit := sigRTMax - sigRTMin; len(presets) > limit {
+		return fmt.Errorf("too many clip presets: %d (at most %d realtime signals are available)", len(presets), limit)
+	}
+	return nil
+}
+
+func presetDuration(sig os.Signal, presets []time.Duration) time.Duration {
+	for i, preset := range presets {
+		if sig == presetSignal(i) {
+			return preset
 		}
 	}
+	return 0
+}
+
+func handleControlRequest(request controlRequest, recorder *Recorder, opts CaptureOptions, buffer clipBuffer, clips *clipQueue, control *controller) {
+	switch request.action {
+	case actionClip:
+		handleClipRequest(opts, buffer, clips, request, control)
+	case actionPause:
+		request.respond(controlReply{err: pauseRecording(recorder, control)})
+	case actionResume:
+		request.respond(controlReply{err: resumeRecording(recorder, control)})
+	case actionStatus:
+		request.respond(controlReply{status: buildStatus(recorder, opts, buffer, clips)})
+	case actionMarker:
+		handleMarkerRequest(recorder, request, control)
+	default:
+		request.respond(controlReply{err: fmt.Errorf("unknown action: %s", request.action)})
+	}
 }
 
-func handleClipRequest(opts CaptureOptions, segmentManager *SegmentManager, clipCounter *int) {
-	if segmentManager == nil {
+func handleMarkerRequest(recorder *Recorder, request controlRequest, control *controller) {
+	marker, err := recorder.AddMarker(request.name)
+	if err != nil {
+		fmt.Printf("\n[MARKER] %v\n", err)
+		request.respond(controlReply{marker: marker, err: err})
 		return
 	}
 
-	fmt.Printf("\n[CLIP] Creating clip of last %d seconds...\n", opts.BufferDuration)
-	duration := time.Duration(opts.BufferDuration) * time.Second
-	segments := segmentManager.GetRecentSegments(duration)
+	fmt.Printf("\n[MARKER] %s\n", marker)
+	control.emit(EventMarkerAdded, marker.String())
+	request.respond(controlReply{marker: marker})
+}
 
-	if len(segments) == 0 {
-		fmt.Println("[CLIP] No segments available yet, wait a bit longer")
+func handlePauseToggle(recorder *Recorder, control *controller) {
+	if recorder.Paused() {
+		resumeRecording(recorder, control)
 		return
 	}
+	pauseRecording(recorder, control)
+}
 
-	clipPath := generateClipPath(opts.OutputPath, opts.Container, *clipCounter)
-	*clipCounter++
+func pauseRecording(recorder *Recorder, control *controller) error {
+	if err := recorder.Pause(); err != nil {
+		fmt.Printf("[PAUSE] Failed to pause: %v\n", err)
+		return err
+	}
+	fmt.Println("\n[PAUSE] Recording paused")
+	control.setState(StatePaused)
+	return nil
+}
 
-	go createClipAsync(segments, clipPath)
+func resumeRecording(recorder *Recorder, control *controller) error {
+	if err := recorder.Resume(); err != nil {
+		fmt.Printf("[PAUSE] Failed to resume: %v\n", err)
+		return err
+	}
+	fmt.Println("\n[PAUSE] Recording resumed")
+	control.setState(StateRecording)
+	return nil
 }
 
-func generateClipPath(basePath, container string, counter int) string {
-	dir := filepath.Dir(basePath)
-	base := strings.TrimSuffix(filepath.Base(basePath), filepath.Ext(basePath))
-	return filepath.Join(dir, fmt.Sprintf("%s-clip-%03d.%s", base, counter, container))
+func handleClipRequest(opts CaptureOptions, buffer clipBuffer, clips *clipQueue, request controlRequest, control *controller) {
+	if buffer == nil {
+		request.respond(controlReply{err: fmt.Errorf("recording is not in clip mode")})
+		return
+	}
+
+	duration := clipDuration(request.duration, opts)
+	if request.duration > duration {
+		fmt.Printf("\n[CLIP] Requested %s is more than the %s buffer\n", request.duration, duration)
+	}
+
+	now := time.Now()
+	from := now.Add(-duration)
+	release := buffer.Hold(from)
+
+	until := now
+	if request.postRoll > 0 {
+		fmt.Printf("\n[CLIP] Creating clip of last %d seconds plus next %d seconds...\n", int(duration.Seconds()), int(request.postRoll.Seconds()))
+		until = now.Add(request.postRoll)
+	} else {
+		fmt.Printf("\n[CLIP] Creating clip of last %d seconds...\n", int(duration.Seconds()))
+	}
+
+	state := ClipJobQueued
+	if until.After(now) {
+		state = ClipJobWaiting
+	}
+	job := clips.add(nextClipPath(opts, clips, request.name, until.Sub(from)), until.Sub(from), state)
+	go createClipAsync(buffer, clips, job, from, until, opts, request, control, release)
 }
 
-func createClipAsync(segments []SegmentInfo, outputPath string) {
-	if err := MergeSegments(segments, outputPath); err != nil {
-		fmt.Printf("[CLIP] Error creating clip: %v\n", err)
+func nextClipPath(opts CaptureOptions, clips *clipQueue, name string, duration time.Duration) string {
+	if name != "" && !strings.Contains(opts.ClipTemplate, "{name}") {
+		return namedClipPath(opts.OutputPath, opts.Container, name)
+	}
+
+	clips.mu.Lock()
+	defer clips.mu.Unlock()
+
+	values := TemplateValues{
+		Counter:  clips.counter,
+		Instance: opts.Instance,
+		Window:   opts.WindowTitle,
+		Profile:  opts.Profile,
+		Name:     name,
+		Base:     strings.TrimSuffix(filepath.Base(opts.OutputPath), filepath.Ext(opts.OutputPath)),
+		Duration: duration,
 	}
+	clipPath := TemplatePath(filepath.Dir(opts.OutputPath), opts.ClipTemplate, opts.Container, &values)
+	clips.counter = values.Counter + 1
+	return clipPath
 }
 
-func handleInterrupt(cmd *exec.Cmd, opts CaptureOptions) error {
-	fmt.Println("\nStopping recording and finalizing...")
-	
-	if cmd.Process == nil {
-		return fmt.Errorf("process not started")
+func namedClipPath(basePath, container, name string) string {
+	return uniquePath(filepath.Join(filepath.Dir(basePath), sanitizeName(name)+"."+container))
+}
+
+// Names end up in file names, which are limited to 255 bytes, and a
+// template can put several of them in one.
+const maxNameBytes = 200
+
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == os.PathSeparator:
+			return '_'
+		case r == '\'' || r == '"' || unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name)
+
+	if len(name) > maxNameBytes {
+		cut := maxNameBytes
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	return name
+}
+
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+func createClipAsync(buffer clipBuffer, clips *clipQueue, job *ClipJob, from, until time.Time, opts CaptureOptions, request controlRequest, control *controller, release func()) {
+	defer release()
+
+	if time.Now().Before(until) {
+		timeout := time.Until(until) + time.Duration(3*opts.SegmentDuration)*time.Second
+		if !buffer.WaitForSegmentAfter(until, timeout) {
+			fmt.Println("[CLIP] Post-roll incomplete, saving the segments available")
+		}
+	}
+
+	err := clips.run(job, func() error {
+		return saveClip(buffer, job.Path, from, until, opts)
+	})
+	if err != nil {
+		fmt.Printf("[CLIP] Error creating clip %d: %v\n", job.ID, err)
+		request.respond(controlReply{err: err})
+		return
+	}
+
+	control.emit(EventClipSaved, job.Path)
+	notify(opts.Notifications, "New clip: "+filepath.Base(job.Path))
+	request.respond(controlReply{value: job.Path})
+}
+
+func saveClip(buffer clipBuffer, outputPath string, from, until time.Time, opts CaptureOptions) error {
+	segments, release, err := buffer.Export(from, until)
+	if err != nil {
+		return err
 	}
-	
-	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
-		return fmt.Errorf("failed to send interrupt signal: %w", err)
+	defer release()
+
+	if len(segments) == 0 {
+		return fmt.Errorf("no segments available yet, wait a bit longer")
 	}
 
-	cmd.Wait()
+	if err := ensureClipSpace(outputPath, segments, opts); err != nil {
+		notify(opts.Notifications, "Clip not saved: low disk space")
+		return err
+	}
+
+	return TrimSegments(segments, from, until, opts, outputPath)
+}
+
+func handleLimits(recorder *Recorder, opts CaptureOptions, buffer clipBuffer, control *controller) error {
+	limit := reachedLimit(recorder, opts)
+	if limit == "" {
+		return nil
+	}
+
+	if opts.Rollover && !opts.ClipMode {
+		nextPath, err := recorder.Rollover()
+		if err != nil {
+			return fmt.Errorf("failed to roll over after %s limit: %w", limit, err)
+		}
+		fmt.Printf("\n[LIMIT] %s reached, continuing in: %s\n", limit, nextPath)
+		return nil
+	}
+
+	fmt.Printf("\n[LIMIT] %s reached\n", limit)
+	if err := handleInterrupt(recorder, opts, buffer, control); err != nil {
+		return err
+	}
+	return &LimitError{Limit: limit}
+}
+
+func handleInterrupt(recorder *Recorder, opts CaptureOptions, buffer clipBuffer, control *controller) error {
+	fmt.Println("\nStopping recording and finalizing...")
+	control.stop()
+	control.setState(StateStopping)
+
+	if err := recorder.Stop(); err != nil {
+		return err
+	}
+	finishPendingClips(buffer)
 
 	if opts.ClipMode && opts.TempDir != "" {
 		cleanupTempFiles(opts.TempDir)
-		cleanupPidFile()
 	}
 
+	printPausedTotal(recorder)
+	control.setState(StateStopped)
 	fmt.Println("Stopped")
 	return nil
 }
 
-func handleFinished(err error) error {
+func handleFinished(recorder *Recorder, err error, buffer clipBuffer, control *controller) error {
+	defer control.setState(StateStopped)
+	finishPendingClips(buffer)
 	if err != nil {
 		return err
 	}
+	if err := recorder.Finished(); err != nil {
+		return err
+	}
+	printPausedTotal(recorder)
 	fmt.Println("Done")
-	cleanupPidFile()
 	return nil
 }
 
-func cleanupTempFiles(tempDir string) {
-	fmt.Println("Cleaning up temporary segments...")
-	os.RemoveAll(tempDir)
-}
-
-func writePidFile() {
-	_ = os.WriteFile(getPidFilePath(), []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
+func finishPendingClips(buffer clipBuffer) {
+	if buffer == nil {
+		return
+	}
+	buffer.Close()
 }
 
-func cleanupPidFile() {
-	_ = os.Remove(getPidFilePath())
+func printPausedTotal(recorder *Recorder) {
+	if paused := recorder.PausedTotal(); paused > 0 {
+		fmt.Printf("Total paused time: %s\n", paused.Round(time.Second))
+	}
 }
 
-func getPidFilePath() string {
-	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
-		return filepath.Join(runtimeDir, "wayland-recorder.pid")
-	}
-	return "/tmp/wayland-recorder.pid"
+func cleanupTempFiles(tempDir string) {
+	fmt.Println("Cleaning up temporary segments...")
+	os.RemoveAll(tempDir)
 }
@@ -0,0 +1,205 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type RecorderClient struct {
+	conn    *dbus.Conn
+	busName string
+	object  dbus.BusObject
+}
+
+type RecorderTarget struct {
+	Instance    string
+	All         bool
+	RunningOnly bool
+}
+
+func ConnectRecorders(target RecorderTarget) ([]*RecorderClient, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	busNames, err := resolveTarget(conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	clients := make([]*RecorderClient, 0, len(busNames))
+	for _, busName := range busNames {
+		clients = append(clients, &RecorderClient{
+			conn:    conn,
+			busName: busName,
+			object:  conn.Object(busName, ControlObjectPath),
+		})
+	}
+	return clients, nil
+}
+
+func resolveTarget(conn *dbus.Conn, target RecorderTarget) ([]string, error) {
+	running, err := recorderNames(conn, "ListNames")
+	if err != nil {
+		return nil, err
+	}
+
+	if target.All {
+		if len(running) == 0 {
+			return nil, fmt.Errorf("no running recording found")
+		}
+		return running, nil
+	}
+
+	if target.Instance != "" || len(running) == 0 {
+		busName := BusName(target.Instance)
+		if !slices.Contains(running, busName) && (target.RunningOnly || !activatable(conn, busName)) {
+			if target.Instance == "" {
+				return nil, fmt.Errorf("no running recording found")
+			}
+			return nil, fmt.Errorf("no running recording for instance %q", target.Instance)
+		}
+		return []string{busName}, nil
+	}
+
+	if slices.Contains(running, ControlBusName) {
+		return []string{ControlBusName}, nil
+	}
+	if len(running) == 1 {
+		return running, nil
+	}
+	return nil, fmt.Errorf("%d recordings are running, choose one with --instance or use --all", len(running))
+}
+
+func activatable(conn *dbus.Conn, busName string) bool {
+	names, err := recorderNames(conn, "ListActivatableNames")
+	return err == nil && slices.Contains(names, busName)
+}
+
+func recorderNames(conn *dbus.Conn, method string) ([]string, error) {
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus."+method, 0).Store(&names); err != nil {
+		return nil, fmt.Errorf("failed to look up recorders: %w", err)
+	}
+
+	var recorders []string
+	for _, name := range names {
+		if isRecorderBusName(name) {
+			recorders = append(recorders, name)
+		}
+	}
+	sort.Strings(recorders)
+	return recorders, nil
+}
+
+func (c *RecorderClient) Close() {
+	c.conn.Close()
+}
+
+func (c *RecorderClient) SaveClip(duration time.Duration, name string) (string, error) {
+	return c.SaveClipWithPostRoll(duration, 0, name)
+}
+
+func (c *RecorderClient) SaveClipWithPostRoll(duration, postRoll time.Duration, name string) (string, error) {
+	var path string
+	err := c.object.Call(ControlInterface+".SaveClipWithPostRoll", 0, int32(duration.Seconds()), int32(postRoll.Seconds()), name).Store(&path)
+	if err != nil {
+		return "", fmt.Errorf("failed to save clip: %w", err)
+	}
+	return path, nil
+}
+
+func (c *RecorderClient) AddMarker(label string) (Marker, error) {
+	var marker Marker
+	err := c.object.Call(ControlInterface+".AddMarker", 0, label).Store(&marker.Time, &marker.Label)
+	if err != nil {
+		return Marker{}, fmt.Errorf("failed to add marker: %w", err)
+	}
+	return marker, nil
+}
+
+func (c *RecorderClient) Stop() error {
+	return c.call("Stop")
+}
+
+func (c *RecorderClient) Pause() error {
+	return c.call("Pause")
+}
+
+func (c *RecorderClient) Resume() error {
+	return c.call("Resume")
+}
+
+func (c *RecorderClient) TogglePause() (string, error) {
+	status, err := c.Status()
+	if err != nil {
+		return "", err
+	}
+	if status.State == StatePaused {
+		return StateRecording, c.Resume()
+	}
+	return StatePaused, c.Pause()
+}
+
+func (c *RecorderClient) Status() (RecorderStatus, error) {
+	var values map[string]dbus.Variant
+	if err := c.object.Call(ControlInterface+".GetStatus", 0).Store(&values); err != nil {
+		return RecorderStatus{}, fmt.Errorf("failed to get status: %w", err)
+	}
+	return statusFromVariants(values), nil
+}
+
+func (c *RecorderClient) call(method string) error {
+	if err := c.object.Call(ControlInterface+"."+method, 0).Err; err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	return nil
+}
+
+func WaitForRecorder(instance string, timeout time.Duration) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	busName := BusName(instance)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var running bool
+		if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, busName).Store(&running); err != nil {
+			return err
+		}
+		if running {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("recorder %s did not start within %s", instance, timeout)
+}
+
+func (c *RecorderClient) WaitForExit(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var running bool
+		err := c.conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, c.busName).Store(&running)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("recorder did not exit within %s", timeout)
+}
@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ClipJobWaiting = "waiting"
+	ClipJobQueued  = "queued"
+	ClipJobRunning = "running"
+	ClipJobDone    = "done"
+	ClipJobFailed  = "failed"
+
+	DefaultClipJobs  = 2
+	finishedJobsKept = 10
+)
+
+type ClipJob struct {
+	ID       int32   `json:"id"`
+	State    string  `json:"state"`
+	Path     string  `json:"path"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type clipQueue struct {
+	mu      sync.Mutex
+	slots   chan struct{}
+	jobs    []*ClipJob
+	nextID  int32
+	counter int
+}
+
+func newClipQueue(concurrency int) *clipQueue {
+	if concurrency <= 0 {
+		concurrency = DefaultClipJobs
+	}
+	return &clipQueue{slots: make(chan struct{}, concurrency), counter: 1}
+}
+
+func (q *clipQueue) add(path string, duration time.Duration, state string) *ClipJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	job := &ClipJob{
+		ID:       q.nextID,
+		State:    state,
+		Path:     q.unclaimedPath(path),
+		Duration: duration.Seconds(),
+	}
+	q.jobs = append(q.jobs, job)
+	q.prune()
+	return job
+}
+
+func (q *clipQueue) unclaimedPath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+	for i := 1; q.claimed(candidate); i++ {
+		candidate = uniquePath(fmt.Sprintf("%s-%d%s", base, i, ext))
+	}
+	return candidate
+}
+
+func (q *clipQueue) claimed(path string) bool {
+	for _, job := range q.jobs {
+		if job.Path == path && !finishedJob(job) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *clipQueue) prune() {
+	finished := 0
+	for _, job := range q.jobs {
+		if finishedJob(job) {
+			finished++
+		}
+	}
+
+	kept := q.jobs[:0]
+	for _, job := range q.jobs {
+		if finishedJob(job) && finished > finishedJobsKept {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+}
+
+func finishedJob(job *ClipJob) bool {
+	return job.State == ClipJobDone || job.State == ClipJobFailed
+}
+
+func (q *clipQueue) setState(job *ClipJob, state string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.State = state
+	if err != nil {
+		job.Error = err.Error()
+	}
+	q.prune()
+}
+
+func (q *clipQueue) run(job *ClipJob, work func() error) error {
+	q.setState(job, ClipJobQueued, nil)
+	q.slots <- struct{}{}
+	defer func() { <-q.slots }()
+
+	q.setState(job, ClipJobRunning, nil)
+	err := work()
+	if err != nil {
+		q.setState(job, ClipJobFailed, err)
+		return err
+	}
+	q.setState(job, ClipJobDone, nil)
+	return nil
+}
+
+func (q *clipQueue) Jobs() []ClipJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]ClipJob, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
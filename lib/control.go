@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	StateRecording = "recording"
+	StatePaused    = "paused"
+	StateStopping  = "stopping"
+	StateStopped   = "stopped"
+
+	EventClipSaved    = "ClipSaved"
+	EventStateChanged = "StateChanged"
+	EventDiskSpace    = "DiskSpace"
+	EventMarkerAdded  = "MarkerAdded"
+)
+
+const (
+	actionClip   = "clip"
+	actionStop   = "stop"
+	actionPause  = "pause"
+	actionResume = "resume"
+	actionStatus = "status"
+	actionMarker = "marker"
+
+	actionSubscribe = "subscribe"
+)
+
+type RecorderStatus struct {
+	Instance       string    `json:"instance"`
+	State          string    `json:"state"`
+	PID            int       `json:"pid"`
+	OutputPath     string    `json:"output"`
+	ClipMode       bool      `json:"clipMode"`
+	Elapsed        float64   `json:"elapsed"`
+	PausedTotal    float64   `json:"pausedTotal"`
+	BufferFill     float64   `json:"bufferFill"`
+	BufferDuration float64   `json:"bufferDuration"`
+	BufferBytes    int64     `json:"bufferBytes"`
+	BufferLimit    int64     `json:"bufferLimit"`
+	FreeSpace      int64     `json:"freeSpace"`
+	DiskWarning    string    `json:"diskWarning,omitempty"`
+	ClipJobs       []ClipJob `json:"clipJobs,omitempty"`
+	DroppedFrames  uint64    `json:"droppedFrames"`
+}
+
+type ControlEvent struct {
+	Name  string
+	Value string
+}
+
+type controlRequest struct {
+	action   string
+	duration time.Duration
+	postRoll time.Duration
+	name     string
+	reply    chan controlReply
+}
+
+type controlReply struct {
+	value  string
+	status RecorderStatus
+	marker Marker
+	err    error
+}
+
+type controller struct {
+	requests chan controlRequest
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu         sync.Mutex
+	listeners  map[int]func(ControlEvent)
+	listenerID int
+}
+
+func newController() *controller {
+	return &controller{
+		requests:  make(chan controlRequest),
+		done:      make(chan struct{}),
+		listeners: make(map[int]func(ControlEvent)),
+	}
+}
+
+func (c *controller) subscribe(listener func(ControlEvent)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.listenerID
+	c.listenerID++
+	c.listeners[id] = listener
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
+func (c *controller) emit(name, value string) {
+	c.mu.Lock()
+	listeners := make([]func(ControlEvent), 0, len(c.listeners))
+	for _, listener := range c.listeners {
+		listeners = append(listeners, listener)
+	}
+	c.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(ControlEvent{Name: name, Value: value})
+	}
+}
+
+func (c *controller) setState(state string) {
+	c.emit(EventStateChanged, state)
+}
+
+func (c *controller) send(action string) controlReply {
+	return c.sendRequest(controlRequest{action: action})
+}
+
+func (c *controller) sendRequest(request controlRequest) controlReply {
+	request.reply = make(chan controlReply, 1)
+	select {
+	case c.requests <- request:
+	case <-c.done:
+		return controlReply{err: fmt.Errorf("recorder is stopping")}
+	}
+	return <-request.reply
+}
+
+func (c *controller) stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
+
+func (r controlRequest) respond(reply controlReply) {
+	if r.reply != nil {
+		r.reply <- reply
+	}
+}
+
+func buildStatus(recorder *Recorder, opts CaptureOptions, buffer clipBuffer, clips *clipQueue) RecorderStatus {
+	status := RecorderStatus{
+		Instance:      opts.Instance,
+		State:         StateRecording,
+		PID:           os.Getpid(),
+		OutputPath:    recorder.OutputPath(),
+		ClipMode:      opts.ClipMode,
+		Elapsed:       recorder.Elapsed().Seconds(),
+		PausedTotal:   recorder.PausedTotal().Seconds(),
+		DroppedFrames: recorder.DroppedFrames(),
+	}
+	if recorder.Paused() {
+		status.State = StatePaused
+	}
+	if free, err := FreeSpace(filepath.Dir(status.OutputPath)); err == nil {
+		status.FreeSpace = free
+	}
+	status.DiskWarning = lowDiskWarning(opts)
+
+	if opts.ClipMode && buffer != nil {
+		status.BufferDuration = float64(opts.BufferDuration)
+		status.BufferFill = min(buffer.Fill().Seconds(), status.BufferDuration)
+		status.BufferBytes = buffer.Size()
+		status.BufferLimit = buffer.Limit()
+		status.ClipJobs = clips.Jobs()
+	}
+	return status
+}
+
+func clipDuration(requested time.Duration, opts CaptureOptions) time.Duration {
+	buffer := time.Duration(opts.BufferDuration) * time.Second
+	if requested <= 0 || requested > buffer {
+		return buffer
+	}
+	return requested
+}
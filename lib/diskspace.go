@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	LowDiskWarn  = "warn"
+	LowDiskPause = "pause"
+
+	diskCheckInterval = 10 * time.Second
+)
+
+func ValidateLowDiskAction(action string) error {
+	switch action {
+	case LowDiskWarn, LowDiskPause:
+		return nil
+	default:
+		return fmt.Errorf("invalid low disk action: %s (use: %s or %s)", action, LowDiskWarn, LowDiskPause)
+	}
+}
+
+func FreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to check free space in %s: %w", path, err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+func watchedDirs(opts CaptureOptions) []string {
+	dirs := []string{filepath.Dir(opts.OutputPath)}
+	if opts.ClipMode && !opts.MemoryBuffer && opts.TempDir != "" {
+		dirs = append(dirs, opts.TempDir)
+	}
+	return dirs
+}
+
+func lowDiskWarning(opts CaptureOptions) string {
+	if opts.MinFreeSpace <= 0 {
+		return ""
+	}
+	for _, dir := range watchedDirs(opts) {
+		free, err := FreeSpace(dir)
+		if err != nil {
+			continue
+		}
+		if free < opts.MinFreeSpace {
+			return fmt.Sprintf("%s free in %s", FormatSize(free), dir)
+		}
+	}
+	return ""
+}
+
+func ensureClipSpace(outputPath string, segments []SegmentInfo, opts CaptureOptions) error {
+	dir := filepath.Dir(outputPath)
+	free, err := FreeSpace(dir)
+	if err != nil {
+		return err
+	}
+
+	var needed int64
+	for _, segment := range segments {
+		needed += segment.Size
+	}
+	if free < needed {
+		return fmt.Errorf("not enough free space in %s: %s free, clip needs about %s", dir, FormatSize(free), FormatSize(needed))
+	}
+	if opts.MinFreeSpace > 0 && free-needed < opts.MinFreeSpace {
+		warning := fmt.Sprintf("%s left in %s after this clip", FormatSize(free-needed), dir)
+		fmt.Printf("\n[DISK] Low disk space: %s\n", warning)
+		notify(opts.Notifications, "Low disk space: "+warning)
+	}
+	return nil
+}
+
+func diskTicker(opts CaptureOptions) (<-chan time.Time, func()) {
+	if opts.MinFreeSpace <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(diskCheckInterval)
+	return ticker.C, ticker.Stop
+}
+
+type diskMonitor struct {
+	opts          CaptureOptions
+	low           bool
+	pausedForDisk bool
+}
+
+func (dm *diskMonitor) check(recorder *Recorder, control *controller) {
+	warning := lowDiskWarning(dm.opts)
+	low := warning != ""
+	if low == dm.low {
+		return
+	}
+	dm.low = low
+
+	if low {
+		fmt.Printf("\n[DISK] Low disk space: %s\n", warning)
+		notify(dm.opts.Notifications, "Low disk space: "+warning)
+		control.emit(EventDiskSpace, warning)
+		if dm.opts.OnLowDisk == LowDiskPause && !recorder.Paused() {
+			dm.pausedForDisk = pauseRecording(recorder, control) == nil
+		}
+		return
+	}
+
+	fmt.Println("\n[DISK] Disk space recovered")
+	control.emit(EventDiskSpace, "")
+	if dm.pausedForDisk && recorder.Paused() {
+		resumeRecording(recorder, control)
+		notify(dm.opts.Notifications, "Disk space recovered, recording resumed")
+	}
+	dm.pausedForDisk = false
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	fragmentOpenedMessage = "splitmuxsink-fragment-opened"
+	fragmentClosedMessage = "splitmuxsink-fragment-closed"
+)
+
+type fragmentTracker struct {
+	mu      sync.Mutex
+	manager *SegmentManager
+	base    time.Time
+	opened  map[string]time.Duration
+}
+
+func newFragmentTracker(manager *SegmentManager) *fragmentTracker {
+	return &fragmentTracker{manager: manager, opened: make(map[string]time.Duration)}
+}
+
+func (ft *fragmentTracker) newRun() {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	ft.base = time.Time{}
+	ft.opened = make(map[string]time.Duration)
+}
+
+func (ft *fragmentTracker) handle(message gstMessage) {
+	name := message.name()
+	if name != fragmentOpenedMessage && name != fragmentClosedMessage {
+		return
+	}
+
+	location, ok := message.field("location")
+	if !ok {
+		return
+	}
+	nanoseconds, ok := message.uintField("running-time")
+	if !ok {
+		return
+	}
+	runningTime := time.Duration(nanoseconds)
+
+	ft.mu.Lock()
+	if base := time.Now().Add(-runningTime); ft.base.IsZero() || base.Before(ft.base) {
+		ft.base = base
+	}
+
+	if name == fragmentOpenedMessage {
+		ft.opened[location] = runningTime
+		ft.mu.Unlock()
+		return
+	}
+
+	openedAt, ok := ft.opened[location]
+	delete(ft.opened, location)
+	base := ft.base
+	ft.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ft.manager.AddSegment(SegmentInfo{
+		Path:      location,
+		StartTime: base.Add(openedAt),
+		EndTime:   base.Add(runningTime),
+		PTS:       openedAt,
+		Duration:  runningTime - openedAt,
+	})
+}
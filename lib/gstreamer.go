@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -16,18 +17,41 @@ const (
 )
 
 type CaptureOptions struct {
-	OutputPath      string
-	Codec           string
-	Container       string
-	EncoderSpeed    int
-	Quality         int
-	AudioMonitor    bool
-	AudioMic        bool
-	BufferDuration  int
-	SegmentDuration int
-	ClipMode        bool
-	TempDir         string
-	Notifications   bool
+	OutputPath          string
+	Codec               string
+	Container           string
+	EncoderSpeed        int
+	Quality             int
+	AudioMonitor        bool
+	AudioMic            bool
+	MicNoiseSuppression string
+	MicGateThreshold    float64
+	PushToTalk          bool
+	BufferDuration      int
+	SegmentDuration     int
+	SegmentStartIndex   int
+	ClipMode            bool
+	TempDir             string
+	Notifications       bool
+	MaxDuration         time.Duration
+	MaxSize             int64
+	Rollover            bool
+	SplitDuration       time.Duration
+	SplitSize           int64
+	SplitManifest       bool
+	CrashSafe           bool
+	Instance            string
+	ClipPresets         []time.Duration
+	MemoryBuffer        bool
+	MemoryLimit         int64
+	BufferMaxSize       int64
+	MinFreeSpace        int64
+	OnLowDisk           string
+	OrphanRetention     time.Duration
+	ClipTemplate        string
+	WindowTitle         string
+	Profile             string
+	ClipJobs            int
 }
 
 func BuildGStreamerArgs(nodeID uint32, opts CaptureOptions) ([]string, error) {
@@ -87,10 +111,14 @@ type muxerConfig struct {
 
 var muxerConfigs = map[string]muxerConfig{
 	"webm": {"webmmux", "streamable=true"},
-	"mp4":  {"mp4mux", "fragment-duration=1000 streamable=true faststart=true"},
+	"mp4":  {"mp4mux", "faststart=true"},
 	"mkv":  {"matroskamux", "streamable=true"},
 }
 
+var crashSafeMuxerConfigs = map[string]muxerConfig{
+	"mp4": {"mp4mux", "fragment-duration=1000 streamable=true"},
+}
+
 func getMuxerConfig(container string) (muxerConfig, error) {
 	config, exists := muxerConfigs[container]
 	if !exists {
@@ -99,11 +127,14 @@ func getMuxerConfig(container string) (muxerConfig, error) {
 	return config, nil
 }
 
-func buildMuxerArgs(container string) ([]string, error) {
+func buildMuxerArgs(container string, crashSafe bool) ([]string, error) {
 	config, err := getMuxerConfig(container)
 	if err != nil {
 		return nil, err
 	}
+	if safeConfig, exists := crashSafeMuxerConfigs[container]; crashSafe && exists {
+		config = safeConfig
+	}
 	args := []string{"!", config.name}
 	if config.streamableParams != "" {
 		args = append(args, strings.Fields(config.streamableParams)...)
@@ -123,16 +154,16 @@ func buildAudioPipeline(opts CaptureOptions) []string {
 		pipeline = []string{
 			"audiomixer", "name=mix",
 			"pulsesrc", "device=@DEFAULT_MONITOR@", "!", "queue", "!", "audioconvert", "!", "mix.",
-			"pulsesrc", "device=@DEFAULT_SOURCE@", "!", "queue", "!", "audioconvert", "!", "mix.",
-			"mix.", "!", "audioresample", "!", "opusenc",
 		}
+		pipeline = append(pipeline, buildMicBranch(opts)...)
+		pipeline = append(pipeline, "!", "mix.",
+			"mix.", "!", "audioresample", "!", "opusenc")
+	} else if opts.AudioMic {
+		pipeline = buildMicBranch(opts)
+		pipeline = append(pipeline, "!", "audioresample", "!", "opusenc")
 	} else {
-		device := "@DEFAULT_MONITOR@"
-		if opts.AudioMic {
-			device = "@DEFAULT_SOURCE@"
-		}
 		pipeline = []string{
-			"pulsesrc", fmt.Sprintf("device=%s", device),
+			"pulsesrc", "device=@DEFAULT_MONITOR@",
 			"!", "queue", "!", "audioconvert", "!", "audioresample", "!", "opusenc",
 		}
 	}
@@ -143,23 +174,24 @@ func buildAudioPipeline(opts CaptureOptions) []string {
 func appendAudioAndOutput(args []string, opts CaptureOptions) []string {
 	audioPipeline := buildAudioPipeline(opts)
 
-	if len(audioPipeline) == 0 {
-		return appendOutputSink(args, opts, "")
+	if opts.Splitting() {
+		return appendSplitOutput(args, opts, audioPipeline)
 	}
 
 	if opts.ClipMode {
-		args = append(args, audioPipeline...)
 		return appendOutputSink(args, opts, "")
 	}
 
-	muxerArgs, err := buildMuxerArgs(opts.Container)
+	muxerArgs, err := buildMuxerArgs(opts.Container, opts.CrashSafe)
 	if err != nil {
 		return appendOutputSink(args, opts, "")
 	}
 
 	args = append(args, muxerArgs...)
-	args = append(args, audioPipeline...)
-	args = append(args, "!", "mux.")
+	if len(audioPipeline) > 0 {
+		args = append(args, audioPipeline...)
+		args = append(args, "!", "mux.")
+	}
 	return appendOutputSink(args, opts, "mux.")
 }
 
@@ -177,13 +209,19 @@ func appendOutputSink(args []string, opts CaptureOptions, prefix string) []strin
 			return args
 		}
 
+		if opts.MemoryBuffer {
+			args = append(args, config.name, "streamable=true", "!", "fdsink", fmt.Sprintf("fd=%d", memoryBufferFd))
+			return args
+		}
+
 		segmentPattern := filepath.Join(opts.TempDir, "segment_%05d."+opts.Container)
 		maxSizeTime := opts.SegmentDuration * 1000000000
 
 		args = append(args, "splitmuxsink",
 			fmt.Sprintf("muxer=%s", config.name),
 			fmt.Sprintf("location=%s", segmentPattern),
-			fmt.Sprintf("max-size-time=%d", maxSizeTime))
+			fmt.Sprintf("max-size-time=%d", maxSizeTime),
+			fmt.Sprintf("start-index=%d", opts.SegmentStartIndex))
 	} else {
 		args = append(args, "filesink", fmt.Sprintf("location=%s", opts.OutputPath))
 	}
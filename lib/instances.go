@@ -0,0 +1,101 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const DefaultInstance = "default"
+
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+func ValidateInstanceName(name string) error {
+	if !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name: %q (use letters, digits and '-', starting with a letter or digit)", name)
+	}
+	return nil
+}
+
+func BusName(instance string) string {
+	if instance == "" || instance == DefaultInstance {
+		return ControlBusName
+	}
+
+	// Instance names have no '_', so this stays one-to-one.
+	element := strings.ReplaceAll(instance, "-", "_")
+	if element[0] >= '0' && element[0] <= '9' {
+		element = "_" + element
+	}
+	return ControlBusName + "." + element
+}
+
+func isRecorderBusName(name string) bool {
+	return name == ControlBusName || strings.HasPrefix(name, ControlBusName+".")
+}
+
+func instanceTempDir(baseDir, instance string) string {
+	return filepath.Join(tempBaseDir(baseDir), fmt.Sprintf("wayland-recorder-%s-%d", instance, os.Getpid()))
+}
+
+func PidFilePath(instance string) string {
+	return filepath.Join(RuntimeDir(), instance+".pid")
+}
+
+func writePidFile(instance string) error {
+	if pid, ok := readPidFile(instance); ok && pid != os.Getpid() && processAlive(pid) {
+		return fmt.Errorf("instance %s is already running (PID %d)", instance, pid)
+	}
+	if err := os.MkdirAll(RuntimeDir(), runtimeDirPermissions); err != nil {
+		return nil
+	}
+	_ = os.WriteFile(PidFilePath(instance), []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
+	return nil
+}
+
+func cleanupPidFile(instance string) {
+	if pid, ok := readPidFile(instance); ok && pid == os.Getpid() {
+		_ = os.Remove(PidFilePath(instance))
+	}
+}
+
+func readPidFile(instance string) (int, bool) {
+	data, err := os.ReadFile(PidFilePath(instance))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func instanceRunning(instance string, pid int) bool {
+	recorded, ok := readPidFile(instance)
+	return ok && recorded == pid && processAlive(pid)
+}
+
+func runningInstances() map[string]int {
+	files, _ := filepath.Glob(filepath.Join(RuntimeDir(), "*.pid"))
+
+	running := make(map[string]int)
+	for _, file := range files {
+		instance := strings.TrimSuffix(filepath.Base(file), ".pid")
+		if pid, ok := readPidFile(instance); ok && processAlive(pid) && pid != os.Getpid() {
+			running[instance] = pid
+		}
+	}
+	return running
+}
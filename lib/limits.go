@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LimitMaxDuration = "max-duration"
+	LimitMaxSize     = "max-size"
+
+	exitCodeMaxDuration = 3
+	exitCodeMaxSize     = 4
+)
+
+type LimitError struct {
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("recording stopped: %s limit reached", e.Limit)
+}
+
+func (e *LimitError) ExitCode() int {
+	if e.Limit == LimitMaxSize {
+		return exitCodeMaxSize
+	}
+	return exitCodeMaxDuration
+}
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+func ParseSize(s string) (int64, error) {
+	normalized := strings.ToLower(strings.TrimSpace(s))
+	if normalized == "" || normalized == "0" {
+		return 0, nil
+	}
+
+	normalized = strings.TrimSuffix(strings.TrimSuffix(normalized, "ib"), "b")
+	numberEnd := strings.IndexFunc(normalized, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := ""
+	if numberEnd >= 0 {
+		unit = normalized[numberEnd:]
+		normalized = normalized[:numberEnd]
+	}
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q (use: K, M, G, or T)", s)
+	}
+
+	value, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+func FormatSize(size int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if multiplier := sizeUnits[strings.ToLower(unit)]; size >= multiplier {
+			return strconv.FormatFloat(float64(size)/float64(multiplier), 'f', 1, 64) + unit
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+func hasLimits(opts CaptureOptions) bool {
+	return opts.MaxDuration > 0 || opts.MaxSize > 0
+}
+
+func reachedLimit(recorder *Recorder, opts CaptureOptions) string {
+	if opts.MaxDuration > 0 && recorder.FileElapsed() >= opts.MaxDuration {
+		return LimitMaxDuration
+	}
+	if opts.MaxSize > 0 && !opts.ClipMode && recorder.OutputSize() >= opts.MaxSize {
+		return LimitMaxSize
+	}
+	return ""
+}
+
+func limitTicker(opts CaptureOptions) (<-chan time.Time, func()) {
+	if !hasLimits(opts) {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(time.Second)
+	return ticker.C, ticker.Stop
+}
@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const markersSuffix = ".markers.json"
+
+type Marker struct {
+	Time    float64   `json:"time"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+	Part    string    `json:"part,omitempty"`
+}
+
+type markerFile struct {
+	Recording string   `json:"recording"`
+	Markers   []Marker `json:"markers"`
+}
+
+func (m Marker) Offset() time.Duration {
+	return secondsToDuration(m.Time)
+}
+
+func (m Marker) String() string {
+	return fmt.Sprintf("%s %s", m.Offset().Round(time.Second), m.Label)
+}
+
+func MarkersPath(recording string) string {
+	return strings.TrimSuffix(recording, filepath.Ext(recording)) + markersSuffix
+}
+
+func LoadMarkers(recording string) ([]Marker, error) {
+	data, err := os.ReadFile(MarkersPath(recording))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read markers: %w", err)
+	}
+
+	var file markerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", MarkersPath(recording), err)
+	}
+	return file.Markers, nil
+}
+
+func writeMarkers(recording string, markers []Marker) error {
+	data, err := json.MarshalIndent(markerFile{Recording: filepath.Base(recording), Markers: markers}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(MarkersPath(recording), data, 0644); err != nil {
+		return fmt.Errorf("failed to write markers: %w", err)
+	}
+	return nil
+}
+
+func embedChapters(recording string, markers []Marker) error {
+	_, duration, err := probeTiming(recording)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := os.CreateTemp(filepath.Dir(recording), "chapters-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create chapter file: %w", err)
+	}
+	defer os.Remove(metadata.Name())
+
+	fmt.Fprintln(metadata, ";FFMETADATA1")
+	for i, marker := range markers {
+		end := duration
+		if i+1 < len(markers) {
+			end = markers[i+1].Offset()
+		}
+		fmt.Fprintf(metadata, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			marker.Offset().Milliseconds(), max(end, marker.Offset()).Milliseconds(), escapeMetadata(marker.Label))
+	}
+	metadata.Close()
+
+	ext := filepath.Ext(recording)
+	output := strings.TrimSuffix(recording, ext) + ".chapters" + ext
+	args := []string{"-v", "error", "-i", recording, "-f", "ffmetadata", "-i", metadata.Name(),
+		"-map", "0", "-map_metadata", "0", "-map_chapters", "1", "-c", "copy"}
+	args = append(args, containerFlags(recording)...)
+	args = append(args, "-y", output)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("ffmpeg failed to write chapters: %w", err)
+	}
+	return os.Rename(output, recording)
+}
+
+func escapeMetadata(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n").Replace(value)
+}
+
+func ExportMarkerClips(recording string, markers []Marker, before, after time.Duration) ([]string, error) {
+	ext := filepath.Ext(recording)
+	base := strings.TrimSuffix(recording, ext)
+
+	var clips []string
+	for i, marker := range markers {
+		start := max(marker.Offset()-before, 0)
+		output := uniquePath(fmt.Sprintf("%s-marker-%02d-%s%s", base, i+1, sanitizeName(marker.Label), ext))
+
+		fmt.Printf("Cutting %s around %s...\n", filepath.Base(output), marker)
+		if err := cutClip(recording, output, start, marker.Offset()+after-start); err != nil {
+			return clips, err
+		}
+		clips = append(clips, output)
+	}
+	return clips, nil
+}
+
+func cutClip(input, output string, start, duration time.Duration) error {
+	args := []string{"-v", "error", "-ss", formatSeconds(start), "-i", input, "-t", formatSeconds(duration), "-map", "0", "-c", "copy"}
+	args = append(args, containerFlags(output)...)
+	args = append(args, "-n", output)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to cut %s: %w", filepath.Base(output), err)
+	}
+	return nil
+}
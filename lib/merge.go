@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 func MergeSegments(segments []SegmentInfo, outputPath string) error {
@@ -18,13 +19,12 @@ func MergeSegments(segments []SegmentInfo, outputPath string) error {
 
 	fmt.Printf("Creating clip from %d segments...\n", len(segments))
 
-	concatFilePath, err := createConcatFile(segments)
-	if err != nil {
-		return err
+	paths := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		paths = append(paths, seg.Path)
 	}
-	defer os.Remove(concatFilePath)
 
-	if err := runFFmpegConcat(concatFilePath, outputPath); err != nil {
+	if err := ConcatFiles(paths, outputPath); err != nil {
 		return err
 	}
 
@@ -32,30 +32,67 @@ func MergeSegments(segments []SegmentInfo, outputPath string) error {
 	return nil
 }
 
-func createConcatFile(segments []SegmentInfo) (string, error) {
-	concatFile := filepath.Join(filepath.Dir(segments[0].Path), "concat_list.txt")
+func ConcatFiles(paths []string, outputPath string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no files to concatenate")
+	}
 
-	f, err := os.Create(concatFile)
+	concatFilePath, err := createConcatFile(paths)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(concatFilePath)
+
+	return runFFmpegConcat(concatFilePath, outputPath)
+}
+
+func createConcatFile(paths []string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(paths[0]), "concat-*.txt")
 	if err != nil {
 		return "", fmt.Errorf("failed to create concat file: %w", err)
 	}
 	defer f.Close()
+	concatFile := f.Name()
 
 	validSegments := 0
-	for _, seg := range segments {
-		if isValidSegment(seg.Path) {
-			fmt.Fprintf(f, "file '%s'\n", seg.Path)
+	for _, path := range paths {
+		if isValidSegment(path) {
+			fmt.Fprintf(f, "file %s\n", concatQuote(path))
 			validSegments++
 		}
 	}
 
 	if validSegments == 0 {
+		os.Remove(concatFile)
 		return "", fmt.Errorf("no valid segments found")
 	}
 
 	return concatFile, nil
 }
 
+func concatQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+func concatUnquote(value string) string {
+	var unquoted strings.Builder
+	quoted, escaped := false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			unquoted.WriteRune(r)
+			escaped = false
+		case r == '\'':
+			quoted = !quoted
+		case r == '\\' && !quoted:
+			escaped = true
+		default:
+			unquoted.WriteRune(r)
+		}
+	}
+	return unquoted.String()
+}
+
 func isValidSegment(path string) bool {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -65,14 +102,16 @@ func isValidSegment(path string) bool {
 }
 
 func runFFmpegConcat(concatFile, outputPath string) error {
-	cmd := exec.Command("ffmpeg",
+	args := []string{
 		"-f", "concat",
 		"-safe", "0",
 		"-i", concatFile,
 		"-c", "copy",
-		"-y",
-		outputPath,
-	)
+	}
+	args = append(args, containerFlags(outputPath)...)
+	args = append(args, "-n", outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const gstMessagePrefix = "Got message #"
+
+var (
+	gstMessageHeader = regexp.MustCompile(`^Got message #\d+ from (?:element|pad|object) "([^"]*)" \(([^)]*)\): ?(.*)$`)
+	gstFieldPattern  = `(?:^|[\s,])%s=\([^)]*\)"?([^,;"]*)`
+	gstFieldRegexps  sync.Map
+)
+
+type gstMessage struct {
+	source    string
+	kind      string
+	structure string
+}
+
+func (m gstMessage) field(name string) (string, bool) {
+	pattern, ok := gstFieldRegexps.Load(name)
+	if !ok {
+		pattern, _ = gstFieldRegexps.LoadOrStore(name, regexp.MustCompile(fmt.Sprintf(gstFieldPattern, regexp.QuoteMeta(name))))
+	}
+	match := pattern.(*regexp.Regexp).FindStringSubmatch(m.structure)
+	if match == nil {
+		return "", false
+	}
+	return strings.TrimSpace(match[1]), true
+}
+
+func (m gstMessage) name() string {
+	name, _, _ := strings.Cut(m.structure, ",")
+	return strings.TrimSuffix(strings.TrimSpace(name), ";")
+}
+
+func (m gstMessage) uintField(name string) (uint64, bool) {
+	value, ok := m.field(name)
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(value, 10, 64)
+	return number, err == nil
+}
+
+func parseGstMessage(line string) (gstMessage, bool) {
+	match := gstMessageHeader.FindStringSubmatch(line)
+	if match == nil {
+		return gstMessage{}, false
+	}
+	return gstMessage{source: match[1], kind: match[2], structure: match[3]}, true
+}
+
+type pipelineStats struct {
+	mu            sync.Mutex
+	droppedByRun  map[string]uint64
+	droppedBefore uint64
+}
+
+func newPipelineStats() *pipelineStats {
+	return &pipelineStats{droppedByRun: make(map[string]uint64)}
+}
+
+func (ps *pipelineStats) newRun() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for _, dropped := range ps.droppedByRun {
+		ps.droppedBefore += dropped
+	}
+	ps.droppedByRun = make(map[string]uint64)
+}
+
+func (ps *pipelineStats) recordQoS(message gstMessage) {
+	dropped, ok := message.uintField("dropped")
+	if !ok {
+		return
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if dropped > ps.droppedByRun[message.source] {
+		ps.droppedByRun[message.source] = dropped
+	}
+}
+
+func (ps *pipelineStats) DroppedFrames() uint64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	total := ps.droppedBefore
+	for _, dropped := range ps.droppedByRun {
+		total += dropped
+	}
+	return total
+}
+
+func watchPipelineOutput(output io.Reader, handle func(gstMessage)) {
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, gstMessagePrefix) {
+			fmt.Fprintln(os.Stdout, line)
+			continue
+		}
+		if message, ok := parseGstMessage(line); ok {
+			handle(message)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import "os/exec"
+
+func notify(enabled bool, message string) {
+	if !enabled {
+		return
+	}
+	cmd := exec.Command(
+		"notify-send",
+		"wayland-recorder",
+		message,
+		"-u",
+		"normal",
+		"-t",
+		"5000",
+	)
+	_ = cmd.Run()
+}
@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const DefaultOrphanRetention = 24 * time.Hour
+
+var (
+	tempDirName       = regexp.MustCompile(`^wayland-recorder-([A-Za-z0-9_-]+)-(\d+)$`)
+	legacyTempDirName = regexp.MustCompile(`^wayland-recorder-(\d+)$`)
+)
+
+type OrphanedBuffer struct {
+	Dir      string
+	Instance string
+	PID      int
+	Legacy   bool
+	Segments []string
+	Size     int64
+	ModTime  time.Time
+}
+
+func tempBaseDir(baseDir string) string {
+	if baseDir == "" {
+		return os.TempDir()
+	}
+	return baseDir
+}
+
+func FindOrphanedBuffers(baseDir string) ([]OrphanedBuffer, error) {
+	baseDir = tempBaseDir(baseDir)
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []OrphanedBuffer
+	for _, entry := range entries {
+		dir := filepath.Join(baseDir, entry.Name())
+		info, err := entry.Info()
+		if !entry.IsDir() || err != nil || !ownedByUser(info) || dir == RuntimeDir() {
+			continue
+		}
+
+		orphan, ok := parseTempDirName(entry.Name())
+		if !ok || orphan.PID == os.Getpid() {
+			continue
+		}
+		if orphan.Legacy && processAlive(orphan.PID) || !orphan.Legacy && instanceRunning(orphan.Instance, orphan.PID) {
+			continue
+		}
+		orphan.Dir = dir
+		orphan.ModTime = info.ModTime()
+
+		segments, _ := filepath.Glob(filepath.Join(dir, "segment_*"))
+		sort.Strings(segments)
+		for _, segment := range segments {
+			info, err := os.Stat(segment)
+			if err != nil || info.Size() < minSegmentSize {
+				continue
+			}
+			orphan.Segments = append(orphan.Segments, segment)
+			orphan.Size += info.Size()
+			if info.ModTime().After(orphan.ModTime) {
+				orphan.ModTime = info.ModTime()
+			}
+		}
+		orphans = append(orphans, orphan)
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].ModTime.Before(orphans[j].ModTime)
+	})
+	return orphans, nil
+}
+
+// Recorders before named instances used wayland-recorder-<pid>, and had no
+// pid file, so those only count as running while the pid is alive.
+func parseTempDirName(name string) (OrphanedBuffer, bool) {
+	if match := tempDirName.FindStringSubmatch(name); match != nil {
+		pid, err := strconv.Atoi(match[2])
+		return OrphanedBuffer{Instance: match[1], PID: pid}, err == nil
+	}
+	if match := legacyTempDirName.FindStringSubmatch(name); match != nil {
+		pid, err := strconv.Atoi(match[1])
+		return OrphanedBuffer{Instance: DefaultInstance, PID: pid, Legacy: true}, err == nil
+	}
+	return OrphanedBuffer{}, false
+}
+
+func ownedByUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
+
+func (o OrphanedBuffer) ClipPath(dir string) string {
+	ext := filepath.Ext(o.Segments[0])
+	name := fmt.Sprintf("recovered-%s-%s%s", o.Instance, o.ModTime.Format("2006-01-02-15-04-05"), ext)
+	return uniquePath(filepath.Join(dir, name))
+}
+
+func SalvageOrphan(orphan OrphanedBuffer, outputPath string, keep bool) error {
+	if len(orphan.Segments) == 0 {
+		return fmt.Errorf("no usable segments in %s", orphan.Dir)
+	}
+
+	err := ConcatFiles(orphan.Segments, outputPath)
+	if err != nil && len(orphan.Segments) > 1 {
+		fmt.Println("Retrying without the last segment, which may have been cut off...")
+		os.Remove(outputPath)
+		err = ConcatFiles(orphan.Segments[:len(orphan.Segments)-1], outputPath)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+
+	if !keep {
+		return os.RemoveAll(orphan.Dir)
+	}
+	return nil
+}
+
+func collectOrphanedBuffers(baseDir string, retention time.Duration) {
+	orphans, err := FindOrphanedBuffers(baseDir)
+	if err != nil || len(orphans) == 0 {
+		return
+	}
+
+	var kept int
+	var keptSize int64
+	for _, orphan := range orphans {
+		if len(orphan.Segments) == 0 || (retention > 0 && time.Since(orphan.ModTime) > retention) {
+			fmt.Printf("Removing clip buffer left by PID %d (%s): %s\n", orphan.PID, FormatSize(orphan.Size), orphan.Dir)
+			os.RemoveAll(orphan.Dir)
+			continue
+		}
+		kept++
+		keptSize += orphan.Size
+	}
+
+	if kept > 0 {
+		fmt.Printf("Found %d clip buffer(s) left by crashed recorders (%s), save them with 'wayland-recorder recover --clips'\n", kept, FormatSize(keptSize))
+	}
+}
@@ -0,0 +1,484 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type pipelineRun struct {
+	cmd  *exec.Cmd
+	done chan error
+}
+
+type Recorder struct {
+	nodeID    uint32
+	opts      CaptureOptions
+	basePath  string
+	fragments *fragmentTracker
+	split     *splitTracker
+	ring      *MemoryRing
+	stats     *pipelineStats
+
+	mu          sync.Mutex
+	run         *pipelineRun
+	currentPath string
+	parts       []string
+	startedAt   time.Time
+	paused      bool
+	pausedAt    time.Time
+	pausedTotal time.Duration
+	fileOffset  time.Duration
+	fileCounter int
+	markers     []Marker
+}
+
+func NewRecorder(nodeID uint32, opts CaptureOptions, buffer clipBuffer) *Recorder {
+	recorder := &Recorder{
+		nodeID:   nodeID,
+		opts:     opts,
+		basePath: opts.OutputPath,
+		stats:    newPipelineStats(),
+	}
+
+	if opts.Splitting() {
+		recorder.split = &splitTracker{}
+	}
+
+	switch buffer := buffer.(type) {
+	case *SegmentManager:
+		recorder.fragments = newFragmentTracker(buffer)
+	case *MemoryRing:
+		recorder.ring = buffer
+	}
+	return recorder
+}
+
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.startRun(r.writePath(r.opts.OutputPath)); err != nil {
+		return err
+	}
+	r.startedAt = time.Now()
+	return nil
+}
+
+func (r *Recorder) startRun(outputPath string) error {
+	runOpts := r.opts
+	runOpts.OutputPath = outputPath
+	if r.opts.ClipMode && !r.opts.MemoryBuffer {
+		runOpts.SegmentStartIndex = nextSegmentIndex(r.opts.TempDir, r.opts.Container)
+	} else if r.opts.Splitting() {
+		runOpts.SegmentStartIndex = len(splitFiles(SplitLocation(outputPath)))
+	}
+
+	args, err := BuildGStreamerArgs(r.nodeID, runOpts)
+	if err != nil {
+		return fmt.Errorf("failed to build GStreamer arguments: %w", err)
+	}
+
+	cmd := exec.Command(gstreamerCommand, append([]string{"-m"}, args...)...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture GStreamer output: %w", err)
+	}
+
+	var bufferOutput *os.File
+	if r.ring != nil {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to create memory buffer pipe: %w", err)
+		}
+		defer writer.Close()
+		cmd.ExtraFiles = []*os.File{writer}
+		bufferOutput = reader
+	}
+
+	if err := cmd.Start(); err != nil {
+		if bufferOutput != nil {
+			bufferOutput.Close()
+		}
+		return fmt.Errorf("failed to start GStreamer: %w", err)
+	}
+	if bufferOutput != nil {
+		go r.ring.Consume(bufferOutput)
+	}
+
+	r.stats.newRun()
+	if r.fragments != nil {
+		r.fragments.newRun()
+	}
+
+	run := &pipelineRun{cmd: cmd, done: make(chan error, 1)}
+	go func() {
+		watchPipelineOutput(output, r.handleMessage)
+		run.done <- cmd.Wait()
+	}()
+
+	r.run = run
+	r.currentPath = outputPath
+	return nil
+}
+
+func (r *Recorder) handleMessage(message gstMessage) {
+	switch {
+	case message.kind == "qos":
+		r.stats.recordQoS(message)
+	case message.kind == "element" && r.fragments != nil:
+		r.fragments.handle(message)
+	case message.kind == "element" && r.split != nil:
+		r.split.handle(message)
+	}
+}
+
+func (r *Recorder) DroppedFrames() uint64 {
+	return r.stats.DroppedFrames()
+}
+
+func (r *Recorder) stopRun() error {
+	run := r.run
+	if run == nil {
+		return nil
+	}
+	r.run = nil
+
+	if run.cmd.Process == nil {
+		return fmt.Errorf("process not started")
+	}
+
+	if err := run.cmd.Process.Signal(syscall.SIGINT); err != nil {
+		return fmt.Errorf("failed to send interrupt signal: %w", err)
+	}
+
+	<-run.done
+	return nil
+}
+
+func (r *Recorder) Done() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.run == nil {
+		return nil
+	}
+	return r.run.done
+}
+
+func (r *Recorder) Paused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused
+}
+
+func (r *Recorder) Pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.paused {
+		return fmt.Errorf("recording is already paused")
+	}
+
+	if err := r.stopRun(); err != nil {
+		return err
+	}
+
+	if r.joinsParts() && len(r.parts) == 0 {
+		r.parts = append(r.parts, r.currentPath)
+	}
+
+	r.paused = true
+	r.pausedAt = time.Now()
+	return nil
+}
+
+func (r *Recorder) Resume() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.paused {
+		return fmt.Errorf("recording is not paused")
+	}
+
+	outputPath := r.writePath(r.opts.OutputPath)
+	if r.joinsParts() && len(r.parts) > 0 {
+		if len(r.parts) == 1 && r.parts[0] == outputPath {
+			firstPart := partPath(outputPath, 0)
+			if err := os.Rename(outputPath, firstPart); err != nil {
+				return fmt.Errorf("failed to move first part: %w", err)
+			}
+			r.parts[0] = firstPart
+		}
+		outputPath = partPath(outputPath, len(r.parts))
+		r.parts = append(r.parts, outputPath)
+	}
+
+	if err := r.startRun(outputPath); err != nil {
+		return err
+	}
+
+	r.pausedTotal += time.Since(r.pausedAt)
+	r.paused = false
+	return nil
+}
+
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.stopRun(); err != nil {
+		return err
+	}
+	if r.paused {
+		r.pausedTotal += time.Since(r.pausedAt)
+		r.paused = false
+	}
+	return r.finalize()
+}
+
+func (r *Recorder) Finished() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.run = nil
+	return r.finalize()
+}
+
+func (r *Recorder) joinsParts() bool {
+	return !r.opts.ClipMode && !r.opts.Splitting()
+}
+
+func (r *Recorder) crashSafe() bool {
+	return r.opts.CrashSafe && r.joinsParts()
+}
+
+func (r *Recorder) writePath(outputPath string) string {
+	if r.crashSafe() {
+		return CrashSafePath(outputPath)
+	}
+	return outputPath
+}
+
+func (r *Recorder) AddMarker(label string) (Marker, error) {
+	elapsed := r.FileElapsed()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.opts.ClipMode {
+		return Marker{}, fmt.Errorf("markers are not available in clip mode, save a clip instead")
+	}
+	if label == "" {
+		label = fmt.Sprintf("Marker %d", len(r.markers)+1)
+	}
+
+	marker := Marker{Time: elapsed.Seconds(), Label: label, Created: time.Now()}
+	if r.split == nil {
+		r.markers = append(r.markers, marker)
+		return marker, writeMarkers(r.opts.OutputPath, r.markers)
+	}
+
+	// Split parts are separate files, so each part gets its own markers
+	// with offsets from the start of that part.
+	part, openedAt := r.split.current()
+	if part == "" {
+		return Marker{}, fmt.Errorf("no split part has been opened yet")
+	}
+	now := time.Now()
+	if r.paused {
+		now = r.pausedAt
+	}
+	marker.Time = max(now.Sub(openedAt), 0).Seconds()
+	marker.Part = filepath.Base(part)
+	r.markers = append(r.markers, marker)
+
+	var partMarkers []Marker
+	for _, m := range r.markers {
+		if m.Part == marker.Part {
+			partMarkers = append(partMarkers, m)
+		}
+	}
+	return marker, writeMarkers(part, partMarkers)
+}
+
+func (r *Recorder) finalize() error {
+	if err := r.finalizeFile(); err != nil {
+		return err
+	}
+
+	markers := r.markers
+	r.markers = nil
+	if len(markers) > 0 && r.split != nil {
+		fmt.Printf("Markers of each part kept next to it in %s files\n", markersSuffix)
+	} else if len(markers) > 0 {
+		fmt.Printf("Writing %d marker(s) as chapters...\n", len(markers))
+		if err := embedChapters(r.opts.OutputPath, markers); err != nil {
+			fmt.Printf("Warning: markers kept only in %s: %v\n", MarkersPath(r.opts.OutputPath), err)
+		}
+	}
+	return nil
+}
+
+func (r *Recorder) finalizeFile() error {
+	if r.opts.Splitting() && r.opts.SplitManifest {
+		manifest, err := writeSplitManifest(SplitLocation(r.opts.OutputPath))
+		if err != nil {
+			return fmt.Errorf("failed to write split manifest: %w", err)
+		}
+		fmt.Printf("Parts listed in: %s\n", manifest)
+	}
+
+	if !r.joinsParts() {
+		return nil
+	}
+
+	if len(r.parts) < 2 {
+		if !r.crashSafe() {
+			return nil
+		}
+		r.parts = nil
+		fmt.Println("Remuxing crash-safe recording...")
+		if err := RemuxFile(r.currentPath, r.opts.OutputPath); err != nil {
+			return fmt.Errorf("failed to remux %s (recover it later with 'recover'): %w", r.currentPath, err)
+		}
+		return os.Remove(r.currentPath)
+	}
+
+	fmt.Printf("Joining %d recorded parts...\n", len(r.parts))
+	if err := ConcatFiles(r.parts, r.opts.OutputPath); err != nil {
+		return fmt.Errorf("failed to join recorded parts (kept in %s): %w", filepath.Dir(r.opts.OutputPath), err)
+	}
+
+	for _, part := range r.parts {
+		os.Remove(part)
+	}
+	r.parts = nil
+	return nil
+}
+
+func (r *Recorder) PausedTotal() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := r.pausedTotal
+	if r.paused {
+		total += time.Since(r.pausedAt)
+	}
+	return total
+}
+
+func (r *Recorder) Elapsed() time.Duration {
+	r.mu.Lock()
+	startedAt := r.startedAt
+	r.mu.Unlock()
+
+	if startedAt.IsZero() {
+		return 0
+	}
+	return time.Since(startedAt) - r.PausedTotal()
+}
+
+func (r *Recorder) FileElapsed() time.Duration {
+	elapsed := r.Elapsed()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return elapsed - r.fileOffset
+}
+
+func (r *Recorder) OutputPath() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.opts.OutputPath
+}
+
+func (r *Recorder) OutputSize() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := append([]string{}, r.parts...)
+	if r.opts.Splitting() {
+		paths = splitFiles(SplitLocation(r.opts.OutputPath))
+	} else if len(paths) == 0 || paths[len(paths)-1] != r.currentPath {
+		paths = append(paths, r.currentPath)
+	}
+
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func (r *Recorder) Rollover() (string, error) {
+	elapsed := r.Elapsed()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.opts.ClipMode {
+		return "", fmt.Errorf("rollover is not supported in clip mode")
+	}
+
+	if err := r.stopRun(); err != nil {
+		return "", err
+	}
+	if err := r.finalize(); err != nil {
+		return "", err
+	}
+
+	if r.fileCounter == 0 {
+		r.fileCounter = 1
+	}
+	r.fileCounter++
+	r.opts.OutputPath = numberedPath(r.basePath, r.fileCounter)
+	r.parts = nil
+	r.fileOffset = elapsed
+
+	if r.paused {
+		return r.opts.OutputPath, nil
+	}
+	if err := r.startRun(r.writePath(r.opts.OutputPath)); err != nil {
+		return "", err
+	}
+	return r.opts.OutputPath, nil
+}
+
+func numberedPath(outputPath string, index int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(outputPath, ext), index, ext)
+}
+
+func partPath(outputPath string, index int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s.part%03d%s", strings.TrimSuffix(outputPath, ext), index, ext)
+}
+
+func nextSegmentIndex(tempDir, container string) int {
+	matches, err := filepath.Glob(filepath.Join(tempDir, "segment_*."+container))
+	if err != nil || len(matches) == 0 {
+		return 0
+	}
+
+	sort.Strings(matches)
+	var last int
+	name := filepath.Base(matches[len(matches)-1])
+	if _, err := fmt.Sscanf(name, "segment_%05d", &last); err != nil {
+		return len(matches)
+	}
+	return last + 1
+}
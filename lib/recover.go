@@ -0,0 +1,248 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	partialMarker = ".partial"
+	clockTicks    = 100
+)
+
+var partSuffix = regexp.MustCompile(`\.part\d{3}$`)
+
+type RecoveryCandidate struct {
+	Inputs []string
+	Output string
+}
+
+func CrashSafePath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + partialMarker + ext
+}
+
+func RemuxFile(inputPath, outputPath string) error {
+	args := []string{"-fflags", "+genpts+discardcorrupt", "-i", inputPath, "-map", "0", "-c", "copy"}
+	args = append(args, containerFlags(outputPath)...)
+	args = append(args, "-n", outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg remux failed: %w", err)
+	}
+	return nil
+}
+
+func containerFlags(outputPath string) []string {
+	if strings.EqualFold(filepath.Ext(outputPath), ".mp4") {
+		return []string{"-movflags", "+faststart"}
+	}
+	return nil
+}
+
+func FindRecoveryCandidates(dir string, minAge time.Duration) ([]RecoveryCandidate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	active := activeRecordings()
+
+	groups := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		output, ok := recoveredPath(path)
+		if !ok || recentlyModified(path, minAge) {
+			continue
+		}
+		if instance, recording := active.owner(output, path); recording {
+			fmt.Printf("Skipping %s, instance %s may still be recording it\n", entry.Name(), instance)
+			continue
+		}
+		groups[output] = append(groups[output], path)
+	}
+
+	candidates := make([]RecoveryCandidate, 0, len(groups))
+	for output, inputs := range groups {
+		sort.Strings(inputs)
+		candidates = append(candidates, RecoveryCandidate{Inputs: inputs, Output: output})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Output < candidates[j].Output
+	})
+	return candidates, nil
+}
+
+func CandidateForFile(path string) RecoveryCandidate {
+	output, ok := recoveredPath(path)
+	if !ok {
+		ext := filepath.Ext(path)
+		output = strings.TrimSuffix(path, ext) + "-recovered" + ext
+	}
+	return RecoveryCandidate{Inputs: []string{path}, Output: output}
+}
+
+func recoveredPath(path string) (string, bool) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	isPart := partSuffix.MatchString(base)
+	base = partSuffix.ReplaceAllString(base, "")
+
+	isPartial := strings.HasSuffix(base, partialMarker)
+	base = strings.TrimSuffix(base, partialMarker)
+
+	if !isPart && !isPartial {
+		return "", false
+	}
+	return base + ext, true
+}
+
+type silentRecorder struct {
+	instance string
+	started  time.Time
+}
+
+type recordingOwners struct {
+	outputs map[string]string
+	silent  []silentRecorder
+}
+
+// A running instance that does not report its output can only own files it
+// wrote since it started.
+func (o recordingOwners) owner(output, input string) (string, bool) {
+	if instance, ok := o.outputs[absolutePath(output)]; ok {
+		return instance, true
+	}
+	info, err := os.Stat(input)
+	for _, recorder := range o.silent {
+		if err != nil || !info.ModTime().Before(recorder.started) {
+			return recorder.instance, true
+		}
+	}
+	return "", false
+}
+
+func activeRecordings() recordingOwners {
+	active := recordingOwners{outputs: make(map[string]string)}
+	for instance, pid := range runningInstances() {
+		response, err := socketRequest(instance, SocketCommand{Command: actionStatus})
+		if err != nil || response.Status == nil {
+			started, _ := processStartTime(pid)
+			active.silent = append(active.silent, silentRecorder{instance: instance, started: started})
+			continue
+		}
+
+		output := response.Status.OutputPath
+		if !filepath.IsAbs(output) {
+			if cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid)); err == nil {
+				output = filepath.Join(cwd, output)
+			}
+		}
+		active.outputs[absolutePath(output)] = instance
+	}
+	return active
+}
+
+func processStartTime(pid int) (time.Time, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+	end := strings.LastIndexByte(string(stat), ')')
+	fields := strings.Fields(string(stat[end+1:]))
+	if end < 0 || len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	boot, ok := bootTime()
+	if !ok {
+		return time.Time{}, false
+	}
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicks), true
+}
+
+func bootTime() (time.Time, bool) {
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, line := range strings.Split(string(stat), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return time.Unix(seconds, 0), err == nil
+		}
+	}
+	return time.Time{}, false
+}
+
+func absolutePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func recentlyModified(path string, minAge time.Duration) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return time.Since(info.ModTime()) < minAge
+}
+
+func Recover(candidate RecoveryCandidate, keepInputs bool) error {
+	active := activeRecordings()
+	for _, input := range candidate.Inputs {
+		if instance, recording := active.owner(candidate.Output, input); recording {
+			return fmt.Errorf("instance %s may still be recording %s", instance, input)
+		}
+	}
+
+	if _, err := os.Stat(candidate.Output); err == nil {
+		return fmt.Errorf("%s already exists, not overwriting", candidate.Output)
+	}
+
+	var err error
+	if len(candidate.Inputs) == 1 {
+		err = RemuxFile(candidate.Inputs[0], candidate.Output)
+	} else {
+		err = ConcatFiles(candidate.Inputs, candidate.Output)
+	}
+	if err != nil {
+		os.Remove(candidate.Output)
+		if strings.EqualFold(filepath.Ext(candidate.Inputs[0]), ".mp4") {
+			return fmt.Errorf("%w (MP4 files only survive crashes when recorded with --crash-safe)", err)
+		}
+		return err
+	}
+
+	if !keepInputs {
+		for _, input := range candidate.Inputs {
+			os.Remove(input)
+		}
+	}
+	return nil
+}
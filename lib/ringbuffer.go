@@ -0,0 +1,353 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const memoryBufferFd = 3
+
+type ringCluster struct {
+	data     []byte
+	start    time.Time
+	end      time.Time
+	offset   time.Duration
+	keyframe bool
+}
+
+type ringStream struct {
+	header   []byte
+	base     time.Time
+	clusters []ringCluster
+}
+
+type MemoryRing struct {
+	mu          sync.Mutex
+	maxDuration time.Duration
+	maxBytes    int64
+	dir         string
+	container   string
+	streams     []*ringStream
+	failure     error
+	size        int64
+	overLimit   bool
+
+	holds      map[int]time.Time
+	nextHoldID int
+	pending    sync.WaitGroup
+	added      chan struct{}
+	closed     bool
+}
+
+func NewMemoryRing(maxDuration time.Duration, maxBytes int64, dir, container string) *MemoryRing {
+	return &MemoryRing{
+		maxDuration: maxDuration,
+		maxBytes:    maxBytes,
+		dir:         dir,
+		container:   container,
+		holds:       make(map[int]time.Time),
+		added:       make(chan struct{}),
+	}
+}
+
+func (mr *MemoryRing) Consume(input io.ReadCloser) {
+	defer input.Close()
+	defer io.Copy(io.Discard, input)
+
+	reader := newWebmReader(input)
+	header, err := reader.readHeader()
+	if err != nil {
+		mr.fail(err)
+		return
+	}
+
+	stream := &ringStream{header: header}
+	mr.mu.Lock()
+	mr.streams = append(mr.streams, stream)
+	mr.failure = nil
+	mr.mu.Unlock()
+
+	for {
+		cluster, err := reader.nextCluster()
+		if err != nil {
+			if err != io.EOF {
+				mr.fail(err)
+			}
+			return
+		}
+		mr.add(stream, cluster, time.Now())
+	}
+}
+
+func (mr *MemoryRing) fail(err error) {
+	fmt.Fprintf(os.Stderr, "\n[BUFFER] Memory buffer stopped, clips cannot be saved: %v\n", err)
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.failure = err
+}
+
+func (mr *MemoryRing) add(stream *ringStream, cluster webmCluster, completedAt time.Time) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if base := completedAt.Add(-cluster.end); stream.base.IsZero() || base.Before(stream.base) {
+		stream.base = base
+	}
+	stream.clusters = append(stream.clusters, ringCluster{
+		data:     cluster.data,
+		start:    stream.base.Add(cluster.start),
+		end:      stream.base.Add(cluster.end),
+		offset:   cluster.start,
+		keyframe: cluster.keyframe,
+	})
+	mr.size += int64(len(cluster.data))
+
+	mr.trim()
+
+	close(mr.added)
+	mr.added = make(chan struct{})
+}
+
+func (mr *MemoryRing) trim() {
+	cutoff := time.Now().Add(-mr.maxDuration)
+	overLimit := false
+
+	for len(mr.streams) > 0 {
+		stream := mr.streams[0]
+		for len(stream.clusters) > 0 {
+			oldest := stream.clusters[0]
+			full := mr.maxBytes > 0 && mr.size > mr.maxBytes
+			if (!oldest.end.Before(cutoff) && !full) || mr.heldFront(stream) {
+				break
+			}
+			overLimit = overLimit || full
+			mr.dropOldest(stream)
+		}
+		for len(stream.clusters) > 0 && !stream.clusters[0].keyframe && !mr.heldFront(stream) {
+			mr.dropOldest(stream)
+		}
+
+		if len(stream.clusters) > 0 || len(mr.streams) == 1 {
+			break
+		}
+		mr.streams = mr.streams[1:]
+	}
+
+	if overLimit && !mr.overLimit {
+		fmt.Printf("\n[BUFFER] Memory limit of %s reached, keeping %s\n", FormatSize(mr.maxBytes), mr.fill().Round(time.Second))
+	}
+	mr.overLimit = overLimit
+}
+
+func (mr *MemoryRing) dropOldest(stream *ringStream) {
+	mr.size -= int64(len(stream.clusters[0].data))
+	stream.clusters[0] = ringCluster{}
+	stream.clusters = stream.clusters[1:]
+}
+
+func (mr *MemoryRing) heldFront(stream *ringStream) bool {
+	for _, since := range mr.holds {
+		if clipStart(stream.clusters, since) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// clipStart returns the keyframe cluster a clip from since has to begin on.
+func clipStart(clusters []ringCluster, since time.Time) int {
+	first := 0
+	for first < len(clusters)-1 && !clusters[first].end.After(since) {
+		first++
+	}
+	for first > 0 && !clusters[first].keyframe {
+		first--
+	}
+	return first
+}
+
+func (mr *MemoryRing) Hold(since time.Time) func() {
+	mr.mu.Lock()
+	id := mr.nextHoldID
+	mr.nextHoldID++
+	mr.holds[id] = since
+	mr.pending.Add(1)
+	mr.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mr.mu.Lock()
+			delete(mr.holds, id)
+			if !mr.closed {
+				mr.trim()
+			}
+			mr.mu.Unlock()
+			mr.pending.Done()
+		})
+	}
+}
+
+func (mr *MemoryRing) WaitForSegmentAfter(t time.Time, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		mr.mu.Lock()
+		if mr.closed {
+			mr.mu.Unlock()
+			return false
+		}
+		if n := len(mr.streams); n > 0 {
+			clusters := mr.streams[n-1].clusters
+			if len(clusters) > 0 && !clusters[len(clusters)-1].end.Before(t) {
+				mr.mu.Unlock()
+				return true
+			}
+		}
+		added := mr.added
+		mr.mu.Unlock()
+
+		select {
+		case <-added:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+func (mr *MemoryRing) Export(from, until time.Time) ([]SegmentInfo, func(), error) {
+	type selection struct {
+		header   []byte
+		clusters []ringCluster
+	}
+
+	mr.mu.Lock()
+	var selected []selection
+	for _, stream := range mr.streams {
+		first, last := -1, -1
+		for i, cluster := range stream.clusters {
+			if cluster.end.After(from) && cluster.start.Before(until) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		for first > 0 && !stream.clusters[first].keyframe {
+			first--
+		}
+		clusters := append([]ringCluster(nil), stream.clusters[first:last+1]...)
+		selected = append(selected, selection{stream.header, clusters})
+	}
+	failure := mr.failure
+	mr.mu.Unlock()
+
+	if len(selected) == 0 && failure != nil {
+		return nil, nil, fmt.Errorf("memory buffer stopped: %w", failure)
+	}
+
+	var segments []SegmentInfo
+	cleanup := func() {
+		for _, segment := range segments {
+			os.Remove(segment.Path)
+		}
+	}
+
+	for _, selection := range selected {
+		path, size, err := writeRingFile(mr.dir, mr.container, selection.header, selection.clusters)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		first, last := selection.clusters[0], selection.clusters[len(selection.clusters)-1]
+		segments = append(segments, SegmentInfo{
+			Path:      path,
+			StartTime: first.start,
+			EndTime:   last.end,
+			PTS:       first.offset,
+			Duration:  last.end.Sub(first.start),
+			Number:    len(segments),
+			Size:      size,
+		})
+	}
+	return segments, cleanup, nil
+}
+
+func writeRingFile(dir, container string, header []byte, clusters []ringCluster) (string, int64, error) {
+	file, err := os.CreateTemp(dir, ".buffer-*."+container)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create buffer file: %w", err)
+	}
+	defer file.Close()
+
+	size := int64(len(header))
+	if _, err := file.Write(header); err != nil {
+		os.Remove(file.Name())
+		return "", 0, fmt.Errorf("failed to write buffer file: %w", err)
+	}
+	for _, cluster := range clusters {
+		if _, err := file.Write(cluster.data); err != nil {
+			os.Remove(file.Name())
+			return "", 0, fmt.Errorf("failed to write buffer file: %w", err)
+		}
+		size += int64(len(cluster.data))
+	}
+	return file.Name(), size, nil
+}
+
+func (mr *MemoryRing) fill() time.Duration {
+	var total time.Duration
+	for _, stream := range mr.streams {
+		if n := len(stream.clusters); n > 0 {
+			total += stream.clusters[n-1].end.Sub(stream.clusters[0].start)
+		}
+	}
+	return total
+}
+
+func (mr *MemoryRing) Fill() time.Duration {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.fill()
+}
+
+func (mr *MemoryRing) Size() int64 {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.size
+}
+
+func (mr *MemoryRing) Limit() int64 {
+	return mr.maxBytes
+}
+
+func memoryLimitLabel(limit int64) string {
+	if limit <= 0 {
+		return "none"
+	}
+	return FormatSize(limit)
+}
+
+func (mr *MemoryRing) Close() {
+	mr.mu.Lock()
+	if !mr.closed {
+		mr.closed = true
+		close(mr.added)
+		mr.added = make(chan struct{})
+	}
+	mr.mu.Unlock()
+
+	mr.pending.Wait()
+}
@@ -5,45 +5,83 @@
 package lib
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unsafe"
 )
 
+const closeWriteGrace = time.Second
+
 type SegmentInfo struct {
 	Path      string
 	StartTime time.Time
+	EndTime   time.Time
+	PTS       time.Duration
+	Duration  time.Duration
 	Number    int
+	Size      int64
 }
 
 type SegmentManager struct {
 	segments    []SegmentInfo
 	maxDuration time.Duration
+	maxBytes    int64
 	tempDir     string
 	mu          sync.Mutex
+	overLimit   bool
+
+	nextNumber int
+	holds      map[int]time.Time
+	nextHoldID int
+	refs       map[string]int
+	pending    sync.WaitGroup
+	added      chan struct{}
+	closed     bool
 }
 
-func NewSegmentManager(maxDuration time.Duration, tempDir string) *SegmentManager {
+func NewSegmentManager(maxDuration time.Duration, maxBytes int64, tempDir string) *SegmentManager {
 	return &SegmentManager{
 		segments:    make([]SegmentInfo, 0),
 		maxDuration: maxDuration,
+		maxBytes:    maxBytes,
 		tempDir:     tempDir,
+		holds:       make(map[int]time.Time),
+		refs:        make(map[string]int),
+		added:       make(chan struct{}),
 	}
 }
 
-func (sm *SegmentManager) AddSegment(path string, number int) {
+func (sm *SegmentManager) AddSegment(segment SegmentInfo) {
+	if segment.Size == 0 {
+		if info, err := os.Stat(segment.Path); err == nil {
+			segment.Size = info.Size()
+		}
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	segment := SegmentInfo{
-		Path:      path,
-		StartTime: time.Now(),
-		Number:    number,
+	for i, existing := range sm.segments {
+		if existing.Path == segment.Path {
+			segment.Number = existing.Number
+			sm.segments[i] = segment
+			return
+		}
 	}
+
+	segment.Number = sm.nextNumber
+	sm.nextNumber++
 	sm.segments = append(sm.segments, segment)
 
 	sm.cleanupOldSegments()
+
+	close(sm.added)
+	sm.added = make(chan struct{})
 }
 
 func (sm *SegmentManager) cleanupOldSegments() {
@@ -51,13 +89,40 @@ func (sm *SegmentManager) cleanupOldSegments() {
 	kept := make([]SegmentInfo, 0, len(sm.segments))
 
 	for _, seg := range sm.segments {
-		if seg.StartTime.After(cutoffTime) {
+		if seg.EndTime.After(cutoffTime) || sm.held(seg) {
 			kept = append(kept, seg)
 		} else {
 			os.Remove(seg.Path)
 		}
 	}
 	sm.segments = kept
+
+	overLimit := false
+	for sm.maxBytes > 0 && sm.size() > sm.maxBytes && len(sm.segments) > 1 && !sm.held(sm.segments[0]) {
+		overLimit = true
+		os.Remove(sm.segments[0].Path)
+		sm.segments = sm.segments[1:]
+	}
+	if overLimit && !sm.overLimit {
+		fmt.Printf("\n[BUFFER] Buffer size limit of %s reached, keeping %s\n", FormatSize(sm.maxBytes), sm.fill().Round(time.Second))
+	}
+	sm.overLimit = overLimit
+}
+
+func (sm *SegmentManager) size() int64 {
+	var total int64
+	for _, seg := range sm.segments {
+		total += seg.Size
+	}
+	return total
+}
+
+func (sm *SegmentManager) fill() time.Duration {
+	var total time.Duration
+	for _, seg := range sm.segments {
+		total += seg.EndTime.Sub(seg.StartTime)
+	}
+	return total
 }
 
 func (sm *SegmentManager) GetRecentSegments(duration time.Duration) []SegmentInfo {
@@ -68,67 +133,207 @@ func (sm *SegmentManager) GetRecentSegments(duration time.Duration) []SegmentInf
 	recent := make([]SegmentInfo, 0)
 
 	for _, seg := range sm.segments {
-		if seg.StartTime.After(cutoffTime) {
+		if seg.EndTime.After(cutoffTime) {
 			recent = append(recent, seg)
 		}
 	}
 	return recent
 }
 
-func MonitorSegments(tempDir string, container string, manager *SegmentManager) {
-	if manager == nil || tempDir == "" || container == "" {
-		return
+func (sm *SegmentManager) held(seg SegmentInfo) bool {
+	if sm.refs[seg.Path] > 0 {
+		return true
 	}
+	for _, since := range sm.holds {
+		if seg.EndTime.After(since) {
+			return true
+		}
+	}
+	return false
+}
 
-	pattern := filepath.Join(tempDir, "segment_*."+container)
-	tracker := newSegmentTracker()
+func (sm *SegmentManager) Hold(since time.Time) func() {
+	sm.mu.Lock()
+	id := sm.nextHoldID
+	sm.nextHoldID++
+	sm.holds[id] = since
+	sm.pending.Add(1)
+	sm.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sm.mu.Lock()
+			delete(sm.holds, id)
+			if !sm.closed {
+				sm.cleanupOldSegments()
+			}
+			sm.mu.Unlock()
+			sm.pending.Done()
+		})
+	}
+}
+
+func (sm *SegmentManager) WaitForSegmentAfter(t time.Time, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	for {
-		time.Sleep(1 * time.Second)
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			continue
+		sm.mu.Lock()
+		if sm.closed {
+			sm.mu.Unlock()
+			return false
+		}
+		for _, seg := range sm.segments {
+			if !seg.EndTime.Before(t) {
+				sm.mu.Unlock()
+				return true
+			}
 		}
+		added := sm.added
+		sm.mu.Unlock()
 
-		for _, match := range matches {
-			tracker.processSegment(match, manager)
+		select {
+		case <-added:
+		case <-timer.C:
+			return false
 		}
 	}
 }
 
-type segmentTracker struct {
-	seen        map[string]bool
-	fileSize    map[string]int64
-	nextNumber  int
+func (sm *SegmentManager) Export(from, until time.Time) ([]SegmentInfo, func(), error) {
+	sm.mu.Lock()
+	var segments []SegmentInfo
+	for _, seg := range sm.segments {
+		if seg.EndTime.After(from) && seg.StartTime.Before(until) {
+			segments = append(segments, seg)
+			sm.refs[seg.Path]++
+		}
+	}
+	sm.mu.Unlock()
+
+	var once sync.Once
+	return segments, func() {
+		once.Do(func() {
+			sm.mu.Lock()
+			defer sm.mu.Unlock()
+			for _, seg := range segments {
+				if sm.refs[seg.Path]--; sm.refs[seg.Path] <= 0 {
+					delete(sm.refs, seg.Path)
+				}
+			}
+			if !sm.closed {
+				sm.cleanupOldSegments()
+			}
+		})
+	}, nil
+}
+
+func (sm *SegmentManager) Fill() time.Duration {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.fill()
+}
+
+func (sm *SegmentManager) Size() int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.size()
+}
+
+func (sm *SegmentManager) Limit() int64 {
+	return sm.maxBytes
+}
+
+func (sm *SegmentManager) Close() {
+	sm.mu.Lock()
+	if !sm.closed {
+		sm.closed = true
+		close(sm.added)
+		sm.added = make(chan struct{})
+	}
+	sm.mu.Unlock()
+
+	sm.pending.Wait()
+}
+
+func (sm *SegmentManager) HasSegment(path string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, seg := range sm.segments {
+		if seg.Path == path {
+			return true
+		}
+	}
+	return false
 }
 
-func newSegmentTracker() *segmentTracker {
-	return &segmentTracker{
-		seen:       make(map[string]bool),
-		fileSize:   make(map[string]int64),
-		nextNumber: 0,
+func WatchSegments(tempDir string, container string, manager *SegmentManager) {
+	if manager == nil || tempDir == "" || container == "" {
+		return
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: inotify unavailable, relying on pipeline messages: %v\n", err)
+		return
+	}
+	defer syscall.Close(fd)
+
+	if _, err := syscall.InotifyAddWatch(fd, tempDir, syscall.IN_CLOSE_WRITE); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to watch %s: %v\n", tempDir, err)
+		return
+	}
+
+	pattern := "segment_*." + container
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(fd, buffer)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			return
+		}
+
+		closedAt := time.Now()
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			if matched, _ := filepath.Match(pattern, name); matched {
+				go addClosedSegment(filepath.Join(tempDir, name), closedAt, manager)
+			}
+		}
 	}
 }
 
-func (st *segmentTracker) processSegment(path string, manager *SegmentManager) bool {
-	if st.seen[path] {
-		return false
+func addClosedSegment(path string, closedAt time.Time, manager *SegmentManager) {
+	time.Sleep(closeWriteGrace)
+	if manager.HasSegment(path) {
+		return
 	}
 
 	info, err := os.Stat(path)
-	if err != nil {
-		return false
+	if err != nil || info.Size() < minSegmentSize {
+		return
 	}
+	manager.AddSegment(probeSegment(path, closedAt))
+}
 
-	prevSize, exists := st.fileSize[path]
-	if exists && prevSize == info.Size() && info.Size() > minSegmentSize {
-		manager.AddSegment(path, st.nextNumber)
-		st.seen[path] = true
-		delete(st.fileSize, path)
-		st.nextNumber++
-		return true
+func probeSegment(path string, closedAt time.Time) SegmentInfo {
+	segment := SegmentInfo{Path: path, StartTime: closedAt, EndTime: closedAt}
+
+	pts, duration, err := probeTiming(path)
+	if err != nil {
+		fmt.Printf("Warning: could not probe %s: %v\n", filepath.Base(path), err)
+		return segment
 	}
-	
-	st.fileSize[path] = info.Size()
-	return false
+	segment.PTS = pts
+	segment.Duration = duration
+	segment.StartTime = closedAt.Add(-duration)
+	return segment
 }
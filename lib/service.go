@@ -0,0 +1,179 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	ControlBusName    = "io.github.WaylandRecorder"
+	ControlObjectPath = "/io/github/WaylandRecorder"
+	ControlInterface  = "io.github.WaylandRecorder"
+)
+
+type controlService struct {
+	conn       *dbus.Conn
+	busName    string
+	controller *controller
+}
+
+func startControlService(ctrl *controller, instance string) (*controlService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	service := &controlService{conn: conn, busName: BusName(instance), controller: ctrl}
+
+	if err := conn.Export(service, ControlObjectPath, ControlInterface); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export control interface: %w", err)
+	}
+	if err := conn.Export(service.introspectable(), ControlObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export introspection data: %w", err)
+	}
+
+	reply, err := conn.RequestName(service.busName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to request bus name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, fmt.Errorf("%s is already owned, is another recorder running with instance %q?", service.busName, instance)
+	}
+
+	ctrl.subscribe(service.emitEvent)
+	return service, nil
+}
+
+func (s *controlService) introspectable() introspect.Introspectable {
+	return introspect.NewIntrospectable(&introspect.Node{
+		Name: ControlObjectPath,
+		Interfaces: []introspect.Interface{{
+			Name:    ControlInterface,
+			Methods: introspect.Methods(s),
+			Signals: []introspect.Signal{
+				{Name: EventClipSaved, Args: []introspect.Arg{{Name: "path", Type: "s"}}},
+				{Name: EventStateChanged, Args: []introspect.Arg{{Name: "state", Type: "s"}}},
+				{Name: EventDiskSpace, Args: []introspect.Arg{{Name: "warning", Type: "s"}}},
+				{Name: EventMarkerAdded, Args: []introspect.Arg{{Name: "marker", Type: "s"}}},
+			},
+		}},
+	})
+}
+
+func (s *controlService) emitEvent(event ControlEvent) {
+	_ = s.conn.Emit(ControlObjectPath, ControlInterface+"."+event.Name, event.Value)
+}
+
+func (s *controlService) Close() {
+	s.conn.ReleaseName(s.busName)
+	s.conn.Close()
+}
+
+func (s *controlService) SaveClip(duration int32) (string, *dbus.Error) {
+	return s.SaveNamedClip(duration, "")
+}
+
+func (s *controlService) SaveNamedClip(duration int32, name string) (string, *dbus.Error) {
+	return s.SaveClipWithPostRoll(duration, 0, name)
+}
+
+func (s *controlService) SaveClipWithPostRoll(duration, postRoll int32, name string) (string, *dbus.Error) {
+	reply := s.controller.sendRequest(controlRequest{
+		action:   actionClip,
+		duration: time.Duration(duration) * time.Second,
+		postRoll: time.Duration(postRoll) * time.Second,
+		name:     name,
+	})
+	if reply.err != nil {
+		return "", dbus.MakeFailedError(reply.err)
+	}
+	return reply.value, nil
+}
+
+func (s *controlService) AddMarker(label string) (float64, string, *dbus.Error) {
+	reply := s.controller.sendRequest(controlRequest{action: actionMarker, name: label})
+	if reply.err != nil {
+		return 0, "", dbus.MakeFailedError(reply.err)
+	}
+	return reply.marker.Time, reply.marker.Label, nil
+}
+
+func (s *controlService) Stop() *dbus.Error {
+	return s.simpleCall(actionStop)
+}
+
+func (s *controlService) Pause() *dbus.Error {
+	return s.simpleCall(actionPause)
+}
+
+func (s *controlService) Resume() *dbus.Error {
+	return s.simpleCall(actionResume)
+}
+
+func (s *controlService) GetStatus() (map[string]dbus.Variant, *dbus.Error) {
+	reply := s.controller.send(actionStatus)
+	if reply.err != nil {
+		return nil, dbus.MakeFailedError(reply.err)
+	}
+	return statusToVariants(reply.status), nil
+}
+
+func (s *controlService) simpleCall(action string) *dbus.Error {
+	if reply := s.controller.send(action); reply.err != nil {
+		return dbus.MakeFailedError(reply.err)
+	}
+	return nil
+}
+
+func statusToVariants(status RecorderStatus) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"instance":        dbus.MakeVariant(status.Instance),
+		"state":           dbus.MakeVariant(status.State),
+		"pid":             dbus.MakeVariant(int32(status.PID)),
+		"output":          dbus.MakeVariant(status.OutputPath),
+		"clip_mode":       dbus.MakeVariant(status.ClipMode),
+		"elapsed":         dbus.MakeVariant(status.Elapsed),
+		"paused_total":    dbus.MakeVariant(status.PausedTotal),
+		"buffer_fill":     dbus.MakeVariant(status.BufferFill),
+		"buffer_duration": dbus.MakeVariant(status.BufferDuration),
+		"buffer_bytes":    dbus.MakeVariant(status.BufferBytes),
+		"buffer_limit":    dbus.MakeVariant(status.BufferLimit),
+		"free_space":      dbus.MakeVariant(status.FreeSpace),
+		"disk_warning":    dbus.MakeVariant(status.DiskWarning),
+		"clip_jobs":       dbus.MakeVariant(status.ClipJobs),
+		"dropped_frames":  dbus.MakeVariant(status.DroppedFrames),
+	}
+}
+
+func statusFromVariants(values map[string]dbus.Variant) RecorderStatus {
+	var status RecorderStatus
+	_ = values["instance"].Store(&status.Instance)
+	_ = values["state"].Store(&status.State)
+	var pid int32
+	_ = values["pid"].Store(&pid)
+	status.PID = int(pid)
+	_ = values["output"].Store(&status.OutputPath)
+	_ = values["clip_mode"].Store(&status.ClipMode)
+	_ = values["elapsed"].Store(&status.Elapsed)
+	_ = values["paused_total"].Store(&status.PausedTotal)
+	_ = values["buffer_fill"].Store(&status.BufferFill)
+	_ = values["buffer_duration"].Store(&status.BufferDuration)
+	_ = values["buffer_bytes"].Store(&status.BufferBytes)
+	_ = values["buffer_limit"].Store(&status.BufferLimit)
+	_ = values["free_space"].Store(&status.FreeSpace)
+	_ = values["disk_warning"].Store(&status.DiskWarning)
+	_ = values["clip_jobs"].Store(&status.ClipJobs)
+	_ = values["dropped_frames"].Store(&status.DroppedFrames)
+	return status
+}
@@ -6,24 +6,49 @@ package lib
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type Settings struct {
-	CursorMode      string `json:"cursorMode"`
-	OutputPath      string `json:"outputPath"`
-	Hotkey          string `json:"hotkey"`
-	Codec           string `json:"codec"`
-	Container       string `json:"container"`
-	EncoderSpeed    int    `json:"encoderSpeed"`
-	Quality         int    `json:"quality"`
-	AudioMonitor    bool   `json:"audioMonitor"`
-	AudioMic        bool   `json:"audioMic"`
-	BufferDuration  int    `json:"bufferDuration"`
-	SegmentDuration int    `json:"segmentDuration"`
-	TempDir         string `json:"tempDir"`
-	Notifications   bool   `json:"notifications"`
+	CursorMode          string    `json:"cursorMode"`
+	OutputPath          string    `json:"outputPath"`
+	Hotkey              string    `json:"hotkey"`
+	PushToTalkKey       string    `json:"pushToTalkKey"`
+	PauseHotkey         string    `json:"pauseHotkey"`
+	Codec               string    `json:"codec"`
+	Container           string    `json:"container"`
+	EncoderSpeed        int       `json:"encoderSpeed"`
+	Quality             int       `json:"quality"`
+	AudioMonitor        bool      `json:"audioMonitor"`
+	AudioMic            bool      `json:"audioMic"`
+	MicNoiseSuppression string    `json:"micNoiseSuppression"`
+	MicGateThreshold    float64   `json:"micGateThreshold"`
+	PushToTalk          bool      `json:"pushToTalk"`
+	BufferDuration      int       `json:"bufferDuration"`
+	SegmentDuration     int       `json:"segmentDuration"`
+	TempDir             string    `json:"tempDir"`
+	Notifications       bool      `json:"notifications"`
+	CrashSafe           bool      `json:"crashSafe"`
+	ClipDuration        int       `json:"clipDuration"`
+	ShortcutProfile     string    `json:"shortcutProfile"`
+	HoldPreRoll         float64   `json:"holdPreRoll"`
+	ClipPresets         []float64 `json:"clipPresets"`
+	MemoryBuffer        bool      `json:"memoryBuffer"`
+	MemoryLimit         string    `json:"memoryLimit"`
+	BufferMaxSize       string    `json:"bufferMaxSize"`
+	MinFreeSpace        string    `json:"minFreeSpace"`
+	OnLowDisk           string    `json:"onLowDisk"`
+	OrphanRetention     string    `json:"orphanRetention"`
+	OutputTemplate      string    `json:"outputTemplate"`
+	ClipTemplate        string    `json:"clipTemplate"`
+	ClipJobs            int       `json:"clipJobs"`
+
+	Shortcuts     map[string]string `json:"shortcuts"`
+	ClipShortcuts []ClipShortcut    `json:"clipShortcuts"`
+
+	Profiles map[string]map[string]any `json:"profiles"`
 }
 
 func LoadSettings() (*Settings, error) {
@@ -45,3 +70,11 @@ func LoadSettings() (*Settings, error) {
 
 	return &settings, nil
 }
+
+func (s *Settings) Profile(name string) (map[string]any, error) {
+	profile, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in settings.json", name)
+	}
+	return profile, nil
+}
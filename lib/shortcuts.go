@@ -8,16 +8,119 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
 
 const (
 	GlobalShortcutsPortal = "org.freedesktop.portal.GlobalShortcuts"
+
+	ShortcutSaveClip     = "save-clip"
+	ShortcutSaveLongClip = "save-long-clip"
+	ShortcutStartStop    = "start-stop"
+	ShortcutPause        = "pause"
+	ShortcutMicMute      = "mic-mute"
+	ShortcutPushToTalk   = "push-to-talk"
+	ShortcutHoldClip     = "hold-clip"
+	ShortcutMarker       = "add-marker"
+
+	startStopInstance    = "toggle"
+	recorderStartTimeout = 2 * time.Minute
+	recorderStopTimeout  = 2 * time.Minute
+
+	listenerRetryMin       = time.Second
+	listenerRetryMax       = 30 * time.Second
+	listenerHealthInterval = 30 * time.Second
+	listenerHealthLogEvery = 10 * time.Minute
 )
 
+type ShortcutBindings map[string]string
+
+type ClipShortcut struct {
+	Name     string  `json:"name"`
+	Key      string  `json:"key"`
+	Duration float64 `json:"duration"`
+	PostRoll float64 `json:"postRoll"`
+}
+
+func (c ClipShortcut) id() string {
+	return "clip-" + c.Name
+}
+
+func (c ClipShortcut) duration() time.Duration {
+	return time.Duration(c.Duration * float64(time.Second))
+}
+
+func (c ClipShortcut) postRoll() time.Duration {
+	return time.Duration(c.PostRoll * float64(time.Second))
+}
+
+type ShortcutOptions struct {
+	Bindings      ShortcutBindings
+	ClipShortcuts []ClipShortcut
+	Target        RecorderTarget
+	ClipDuration  time.Duration
+	HoldPreRoll   time.Duration
+	Profile       string
+	Notifications bool
+}
+
+type shortcutAction struct {
+	id          string
+	description string
+	activated   func(*shortcutHandler)
+	deactivated func(*shortcutHandler)
+}
+
+var shortcutActions = []shortcutAction{
+	{id: ShortcutSaveClip, description: "Save a clip", activated: (*shortcutHandler).saveClip},
+	{id: ShortcutSaveLongClip, description: "Save the whole clip buffer", activated: (*shortcutHandler).saveLongClip},
+	{id: ShortcutStartStop, description: "Start or stop recording", activated: (*shortcutHandler).startStop},
+	{id: ShortcutPause, description: "Pause or resume recording", activated: (*shortcutHandler).togglePause},
+	{id: ShortcutMicMute, description: "Mute or unmute the microphone", activated: (*shortcutHandler).toggleMicMute},
+	{id: ShortcutMarker, description: "Add a marker to the recording", activated: (*shortcutHandler).addMarker},
+	{
+		id:          ShortcutPushToTalk,
+		description: "Hold to talk while recording",
+		activated:   func(h *shortcutHandler) { h.setPushToTalk(true) },
+		deactivated: func(h *shortcutHandler) { h.setPushToTalk(false) },
+	},
+	{
+		id:          ShortcutHoldClip,
+		description: "Hold to mark a clip, release to save it",
+		activated:   (*shortcutHandler).startHold,
+		deactivated: (*shortcutHandler).finishHold,
+	},
+}
+
+func ShortcutActionIDs() []string {
+	ids := make([]string, len(shortcutActions))
+	for i, action := range shortcutActions {
+		ids[i] = action.id
+	}
+	return ids
+}
+
+func findShortcutAction(id string) (shortcutAction, bool) {
+	for _, action := range shortcutActions {
+		if action.id == id {
+			return action, true
+		}
+	}
+	return shortcutAction{}, false
+}
+
+func ValidateShortcutAction(id string) error {
+	if _, ok := findShortcutAction(id); !ok {
+		return fmt.Errorf("unknown shortcut action: %s (use: %s)", id, strings.Join(ShortcutActionIDs(), ", "))
+	}
+	return nil
+}
+
 type shortcutStruct struct {
 	ID   string
 	Data map[string]dbus.Variant
@@ -100,15 +203,7 @@ func createShortcutSession(conn *dbus.Conn, portal dbus.BusObject) (dbus.ObjectP
 	return dbus.ObjectPath(sessionHandle), nil
 }
 
-func bindShortcut(conn *dbus.Conn, portal dbus.BusObject, sessionPath dbus.ObjectPath, parsedShortcut, description string) error {
-	shortcuts := []shortcutStruct{{
-		ID: "record-shortcut",
-		Data: map[string]dbus.Variant{
-			"description":       dbus.MakeVariant(description),
-			"preferred_trigger": dbus.MakeVariant(parsedShortcut),
-		},
-	}}
-
+func bindShortcuts(conn *dbus.Conn, portal dbus.BusObject, sessionPath dbus.ObjectPath, shortcuts []shortcutStruct) error {
 	bindOptions := map[string]dbus.Variant{
 		"handle_token": dbus.MakeVariant(generateToken()),
 	}
@@ -125,190 +220,458 @@ func bindShortcut(conn *dbus.Conn, portal dbus.BusObject, sessionPath dbus.Objec
 		return fmt.Errorf("failed to get bind response: %w", err)
 	}
 
-	printBindResult(bindResponse, parsedShortcut)
+	printBindResult(bindResponse, shortcuts)
 	return nil
 }
 
-func printBindResult(bindResponse map[string]dbus.Variant, parsedShortcut string) {
+func newShortcut(id, parsedShortcut, description string) shortcutStruct {
+	return shortcutStruct{
+		ID: id,
+		Data: map[string]dbus.Variant{
+			"description":       dbus.MakeVariant(description),
+			"preferred_trigger": dbus.MakeVariant(parsedShortcut),
+		},
+	}
+}
+
+func printBindResult(bindResponse map[string]dbus.Variant, shortcuts []shortcutStruct) {
 	shortcutsVariant, ok := bindResponse["shortcuts"]
 	if !ok {
 		return
 	}
 
-	bindShortcuts, ok := shortcutsVariant.Value().([]map[string]dbus.Variant)
-	if ok && len(bindShortcuts) > 0 {
-		fmt.Printf("New shortcut registered: %s\n", parsedShortcut)
+	bound, ok := shortcutsVariant.Value().([][]interface{})
+	if !ok || len(bound) == 0 {
+		return
+	}
+
+	for _, shortcut := range shortcuts {
+		fmt.Printf("New shortcut registered: %s (%s)\n", shortcut.Data["preferred_trigger"].Value(), shortcut.ID)
 	}
 }
 
-func listenForActivation(conn *dbus.Conn, sessionPath dbus.ObjectPath, execPath string) error {
+func listenForActivation(conn *dbus.Conn, portal dbus.BusObject, sessionPath dbus.ObjectPath, handler *shortcutHandler) error {
 	signalChannel := make(chan *dbus.Signal, 10)
 	conn.Signal(signalChannel)
+	defer conn.RemoveSignal(signalChannel)
 
-	matchRule := fmt.Sprintf("type='signal',interface='org.freedesktop.portal.GlobalShortcuts',member='Activated',path='%s'", sessionPath)
-	conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, matchRule)
-	defer conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, matchRule)
+	matchRules := []string{
+		fmt.Sprintf("type='signal',interface='org.freedesktop.portal.GlobalShortcuts',path='%s'", sessionPath),
+		fmt.Sprintf("type='signal',interface='org.freedesktop.portal.Session',member='Closed',path='%s'", sessionPath),
+		fmt.Sprintf("type='signal',interface='org.freedesktop.DBus',member='NameOwnerChanged',arg0='%s'", PortalServiceName),
+	}
+	for _, rule := range matchRules {
+		conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule)
+		defer conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, rule)
+	}
 
 	fmt.Println("Listening for shortcut activation... (Press Ctrl+C to stop)")
 
-	for signal := range signalChannel {
-		if signal.Name == "org.freedesktop.portal.GlobalShortcuts.Activated" {
-			handleShortcutActivation(execPath)
+	health := time.NewTicker(listenerHealthInterval)
+	defer health.Stop()
+	lastHealthLog := time.Now()
+
+	for {
+		select {
+		case signal, ok := <-signalChannel:
+			if !ok {
+				return fmt.Errorf("session bus connection closed")
+			}
+			switch signal.Name {
+			case "org.freedesktop.DBus.NameOwnerChanged":
+				return fmt.Errorf("desktop portal restarted")
+			case "org.freedesktop.portal.Session.Closed":
+				return fmt.Errorf("shortcut session closed by the portal")
+			case "org.freedesktop.portal.GlobalShortcuts.ShortcutsChanged":
+				handleShortcutsChanged(signal)
+			default:
+				if dispatchShortcutSignal(signal, handler) {
+					handler.activations++
+				}
+			}
+
+		case <-health.C:
+			if err := portal.Call("org.freedesktop.DBus.Peer.Ping", 0).Err; err != nil {
+				return fmt.Errorf("desktop portal not responding: %w", err)
+			}
+			if time.Since(lastHealthLog) >= listenerHealthLogEvery {
+				fmt.Printf("[SHORTCUT] Listener healthy, %d activations since %s\n", handler.activations, handler.connectedAt.Format("15:04:05"))
+				lastHealthLog = time.Now()
+			}
 		}
 	}
+}
+
+func dispatchShortcutSignal(signal *dbus.Signal, handler *shortcutHandler) bool {
+	shortcutID, ok := shortcutIDFromSignal(signal)
+	if !ok {
+		return false
+	}
+	action, ok := handler.findAction(shortcutID)
+	if !ok {
+		return false
+	}
 
-	return nil
+	// The portal timestamp is on the compositor's clock and may be 0, so
+	// press and release are both timed on arrival instead.
+	handler.eventTime = time.Now()
+	switch signal.Name {
+	case "org.freedesktop.portal.GlobalShortcuts.Activated":
+		if action.deactivated != nil {
+			action.activated(handler)
+		} else {
+			go action.activated(handler)
+		}
+		return true
+	case "org.freedesktop.portal.GlobalShortcuts.Deactivated":
+		if action.deactivated != nil {
+			action.deactivated(handler)
+		}
+	}
+	return false
 }
 
-func handleShortcutActivation(execPath string) {
-	fmt.Println("Shortcut activated! Sending clip signal...")
+func shortcutIDFromSignal(signal *dbus.Signal) (string, bool) {
+	if len(signal.Body) < 2 {
+		return "", false
+	}
+	shortcutID, ok := signal.Body[1].(string)
+	return shortcutID, ok
+}
 
-	pid, err := findRecordingProcess()
+func (h *shortcutHandler) setPushToTalk(talking bool) {
+	instances, err := h.micInstances()
 	if err != nil {
-		fmt.Printf("Failed to find recording process: %v\n", err)
-		fmt.Println("Is the recording process running with --clip-mode?")
+		fmt.Printf("Push-to-talk failed: %v\n", err)
 		return
 	}
 
-	if err := sendClipSignal(pid); err != nil {
-		fmt.Printf("Failed to send signal to process %d: %v\n", pid, err)
-		return
+	for _, instance := range instances {
+		if err := SetMicMuted(instance, !talking); err != nil {
+			fmt.Printf("Push-to-talk failed: %v\n", err)
+			continue
+		}
+		if talking {
+			fmt.Printf("Push-to-talk: microphone live (%s)\n", instance)
+		} else {
+			fmt.Printf("Push-to-talk: microphone muted (%s)\n", instance)
+		}
 	}
-
-	fmt.Printf("Clip signal sent to process %d\n", pid)
 }
 
-func sendClipSignal(pid int) error {
-	process, err := os.FindProcess(pid)
+func (h *shortcutHandler) micInstances() ([]string, error) {
+	if h.options.Target.Instance != "" {
+		return []string{h.options.Target.Instance}, nil
+	}
+
+	clients, err := ConnectRecorders(h.options.Target)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = process.Signal(syscall.SIGUSR1)
-	if err == nil && notificationsEnabled(pid) {
-		cmd := exec.Command(
-			"notify-send",
-			"wayland-recorder",
-			"New clip!",
-			"-u",
-			"normal",
-			"-t",
-			"5000",
-		)
-		_ = cmd.Run()
+	defer clients[0].Close()
+
+	instances := make([]string, 0, len(clients))
+	for _, client := range clients {
+		status, err := client.Status()
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, status.Instance)
 	}
+	return instances, nil
+}
+
+type shortcutHandler struct {
+	execPath  string
+	options   ShortcutOptions
+	toggling  sync.Mutex
+	eventTime time.Time
+	heldSince time.Time
 
-	return err
+	connectedAt time.Time
+	activations int
 }
 
-func notificationsEnabled(pid int) bool {
-	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
-	if err == nil {
-		cmdStr := string(cmdline)
-		if strings.Contains(cmdStr, "--no-notifications") {
-			return false
+func (h *shortcutHandler) findAction(id string) (shortcutAction, bool) {
+	if action, ok := findShortcutAction(id); ok {
+		return action, true
+	}
+	for _, clip := range h.options.ClipShortcuts {
+		if clip.id() == id {
+			duration, postRoll := clip.duration(), clip.postRoll()
+			return shortcutAction{id: id, activated: func(h *shortcutHandler) { h.requestClip(duration, postRoll) }}, true
 		}
 	}
+	return shortcutAction{}, false
+}
 
-	if settings, err := LoadSettings(); err == nil {
-		return settings.Notifications
-	}
+func (h *shortcutHandler) saveClip() {
+	h.requestClip(h.options.ClipDuration, 0)
+}
 
-	return true
+func (h *shortcutHandler) saveLongClip() {
+	h.requestClip(0, 0)
 }
 
-func findRecordingProcess() (int, error) {
-	if pid, err := pidFromFile(); err == nil {
-		return pid, nil
-	}
+func (h *shortcutHandler) startHold() {
+	h.heldSince = h.eventTime
+	fmt.Println("Clip start marked, release to save")
+}
 
-	if pid, err := pidFromProcScan(); err == nil {
-		return pid, nil
+func (h *shortcutHandler) finishHold() {
+	if h.heldSince.IsZero() {
+		return
+	}
+	held := h.eventTime.Sub(h.heldSince)
+	h.heldSince = time.Time{}
+	if held < 0 {
+		held = 0
 	}
 
-	return 0, fmt.Errorf("no clip-mode recording found; start with --clip-mode")
+	duration := (held + h.options.HoldPreRoll + time.Second - 1).Truncate(time.Second)
+	fmt.Printf("Held for %s, saving %s including %s pre-roll\n", held.Round(100*time.Millisecond), duration, h.options.HoldPreRoll)
+	go h.requestClip(duration, 0)
 }
 
-func pidFromFile() (int, error) {
-	data, err := os.ReadFile(getPidFilePath())
+func (h *shortcutHandler) requestClip(duration, postRoll time.Duration) {
+	fmt.Println("Shortcut activated! Requesting clip...")
+
+	clients, err := ConnectRecorders(h.options.Target)
 	if err != nil {
-		return 0, err
+		fmt.Printf("Failed to find recording process: %v\n", err)
+		fmt.Println("Is the recording process running with --clip-mode?")
+		return
 	}
+	defer clients[0].Close()
 
-	var pid int
-	if _, err := fmt.Sscanf(string(data), "%d", &pid); err != nil {
-		return 0, err
+	for _, client := range clients {
+		path, err := client.SaveClipWithPostRoll(duration, postRoll, "")
+		if err != nil {
+			fmt.Printf("Failed to save clip: %v\n", err)
+			continue
+		}
+		fmt.Printf("Clip saved to: %s\n", path)
 	}
+}
 
-	if !processLooksLikeClipMode(pid) {
-		return 0, fmt.Errorf("pid file does not point to clip-mode process")
+func (h *shortcutHandler) togglePause() {
+	clients, err := ConnectRecorders(h.options.Target)
+	if err != nil {
+		fmt.Printf("Failed to find recording process: %v\n", err)
+		return
 	}
+	defer clients[0].Close()
 
-	return pid, nil
+	for _, client := range clients {
+		state, err := client.TogglePause()
+		if err != nil {
+			fmt.Printf("Failed to toggle pause: %v\n", err)
+			continue
+		}
+		fmt.Printf("Recording is now %s\n", state)
+	}
 }
 
-func pidFromProcScan() (int, error) {
-	entries, err := os.ReadDir("/proc")
+func (h *shortcutHandler) addMarker() {
+	clients, err := ConnectRecorders(h.options.Target)
 	if err != nil {
-		return 0, err
+		fmt.Printf("Failed to find recording process: %v\n", err)
+		return
 	}
+	defer clients[0].Close()
 
-	for _, entry := range entries {
-		var pid int
-		if _, err := fmt.Sscanf(entry.Name(), "%d", &pid); err != nil {
+	for _, client := range clients {
+		marker, err := client.AddMarker("")
+		if err != nil {
+			fmt.Printf("Failed to add marker: %v\n", err)
 			continue
 		}
+		fmt.Printf("Marker added: %s\n", marker)
+	}
+}
+
+func (h *shortcutHandler) toggleMicMute() {
+	instances, err := h.micInstances()
+	if err != nil {
+		fmt.Printf("Failed to toggle microphone: %v\n", err)
+		return
+	}
 
-		if processLooksLikeClipMode(pid) {
-			return pid, nil
+	for _, instance := range instances {
+		muted, err := ToggleMicMuted(instance)
+		if err != nil {
+			fmt.Printf("Failed to toggle microphone: %v\n", err)
+			continue
+		}
+		if muted {
+			fmt.Printf("Microphone muted (%s)\n", instance)
+		} else {
+			fmt.Printf("Microphone live (%s)\n", instance)
 		}
 	}
+}
+
+func (h *shortcutHandler) startStop() {
+	if !h.toggling.TryLock() {
+		fmt.Println("Start/stop already in progress")
+		return
+	}
+	defer h.toggling.Unlock()
+
+	instance := h.options.Target.Instance
+	if instance == "" {
+		instance = startStopInstance
+	}
+
+	client, err := ConnectRecorders(RecorderTarget{Instance: instance, RunningOnly: true})
+	if err == nil {
+		defer client[0].Close()
+		h.stopRecording(client[0])
+		return
+	}
+	h.startRecording(instance)
+}
+
+func (h *shortcutHandler) startRecording(instance string) {
+	args := []string{"record", "--daemon", "--instance", instance}
+	if h.options.Profile != "" {
+		args = append(args, "--profile", h.options.Profile)
+	}
+	fmt.Printf("Starting recording (instance %s)...\n", instance)
+
+	cmd := exec.Command(h.execPath, args...)
+	cmd.Env = withoutSystemdEnv(os.Environ())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Failed to start recording: %v\n", err)
+		notify(h.options.Notifications, "Failed to start recording")
+		return
+	}
 
-	return 0, fmt.Errorf("no clip-mode process in /proc")
+	if err := WaitForRecorder(instance, recorderStartTimeout); err != nil {
+		fmt.Printf("Recording did not start: %v\n", err)
+		notify(h.options.Notifications, "Recording did not start")
+		return
+	}
+	fmt.Println("Recording started")
+	notify(h.options.Notifications, "Recording started")
 }
 
-func processLooksLikeClipMode(pid int) bool {
-	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+func (h *shortcutHandler) stopRecording(client *RecorderClient) {
+	status, err := client.Status()
 	if err != nil {
-		return false
+		fmt.Printf("Failed to get recording status: %v\n", err)
+		return
+	}
+
+	fmt.Println("Stopping recording...")
+	if err := client.Stop(); err != nil {
+		fmt.Printf("Failed to stop recording: %v\n", err)
+		notify(h.options.Notifications, "Failed to stop recording")
+		return
+	}
+	if err := client.WaitForExit(recorderStopTimeout); err != nil {
+		fmt.Printf("Recording did not stop cleanly: %v\n", err)
+		notify(h.options.Notifications, "Recording did not stop cleanly")
+		return
 	}
 
-	cmdStr := string(cmdline)
-	return strings.Contains(cmdStr, "wayland-recorder") &&
-		strings.Contains(cmdStr, "record") &&
-		strings.Contains(cmdStr, "clip-mode")
+	fmt.Printf("Recording saved to: %s\n", status.OutputPath)
+	notify(h.options.Notifications, "Recording saved: "+filepath.Base(status.OutputPath))
 }
 
-func RegisterShortcut(shortcut, description string) error {
-	if shortcut == "" {
-		return fmt.Errorf("empty shortcut")
+func RegisterShortcuts(options ShortcutOptions) error {
+	var shortcuts []shortcutStruct
+	for _, action := range shortcutActions {
+		key := options.Bindings[action.id]
+		if key == "" {
+			continue
+		}
+		parsedShortcut, err := ParseShortcut(key)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s shortcut: %w", action.id, err)
+		}
+		shortcuts = append(shortcuts, newShortcut(action.id, parsedShortcut, action.description))
+	}
+	for _, clip := range options.ClipShortcuts {
+		if clip.Name == "" || clip.Key == "" || clip.Duration <= 0 {
+			return fmt.Errorf("clip shortcut needs a name, key and positive duration: %+v", clip)
+		}
+		parsedShortcut, err := ParseShortcut(clip.Key)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s shortcut: %w", clip.id(), err)
+		}
+		description := fmt.Sprintf("Save the last %s", clip.duration())
+		if clip.PostRoll > 0 {
+			description += fmt.Sprintf(" and next %s", clip.postRoll())
+		}
+		shortcuts = append(shortcuts, newShortcut(clip.id(), parsedShortcut, description))
+	}
+	if len(shortcuts) == 0 {
+		return fmt.Errorf("no shortcuts configured")
 	}
 
-	conn, err := dbus.ConnectSessionBus()
+	execPath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to connect to session bus: %w", err)
+		return fmt.Errorf("failed to get executable path: %w", err)
 	}
-	defer conn.Close()
+	handler := &shortcutHandler{execPath: execPath, options: options}
+
+	connected := false
+	retry := listenerRetryMin
+	for {
+		started := time.Now()
+		established, err := runShortcutSession(shortcuts, handler)
+		connected = connected || established
+		if !connected {
+			return err
+		}
 
-	parsedShortcut, err := ParseShortcut(shortcut)
+		if time.Since(started) > listenerRetryMax {
+			retry = listenerRetryMin
+		}
+		fmt.Printf("[SHORTCUT] Listener stopped: %v, reconnecting in %s\n", err, retry)
+		time.Sleep(retry)
+		retry = min(retry*2, listenerRetryMax)
+	}
+}
+
+func runShortcutSession(shortcuts []shortcutStruct, handler *shortcutHandler) (bool, error) {
+	conn, err := dbus.ConnectSessionBus()
 	if err != nil {
-		return fmt.Errorf("failed to parse shortcut: %w", err)
+		return false, fmt.Errorf("failed to connect to session bus: %w", err)
 	}
+	defer conn.Close()
 
 	portal := conn.Object(PortalServiceName, PortalObjectPath)
 
 	sessionPath, err := createShortcutSession(conn, portal)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	execPath, err := os.Executable()
+	state := loadShortcutState()
+	bound, err := listShortcuts(conn, portal, sessionPath)
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %w", err)
+		fmt.Printf("Warning: %v\n", err)
 	}
 
-	if err := bindShortcut(conn, portal, sessionPath, parsedShortcut, description); err != nil {
-		return err
+	if err != nil || needsBind(shortcuts, bound, state) {
+		if err := bindShortcuts(conn, portal, sessionPath, shortcuts); err != nil {
+			return false, err
+		}
+		if bound, err = listShortcuts(conn, portal, sessionPath); err != nil {
+			bound = nil
+		}
+	} else {
+		fmt.Println("Reusing existing shortcut bindings:")
+		printBoundShortcuts(bound)
 	}
+	saveShortcutState(shortcutState{Requested: requestedTriggers(shortcuts), Bound: bound})
 
-	return listenForActivation(conn, sessionPath, execPath)
+	handler.connectedAt = time.Now()
+	handler.activations = 0
+	fmt.Printf("[SHORTCUT] Session established: %s\n", sessionPath)
+	return true, listenForActivation(conn, portal, sessionPath, handler)
 }
@@ -0,0 +1,234 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	socketDialTimeout     = time.Second
+	socketRequestTimeout  = 5 * time.Second
+	socketWriteTimeout    = 2 * time.Second
+	subscriberBacklog     = 64
+	runtimeDirPermissions = 0700
+)
+
+type SocketCommand struct {
+	Command  string  `json:"command"`
+	Duration float64 `json:"duration,omitempty"`
+	PostRoll float64 `json:"postRoll,omitempty"`
+	Name     string  `json:"name,omitempty"`
+}
+
+type SocketResponse struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Path   string          `json:"path,omitempty"`
+	Status *RecorderStatus `json:"status,omitempty"`
+	Marker *Marker         `json:"marker,omitempty"`
+}
+
+type SocketEvent struct {
+	Event string `json:"event"`
+	Value string `json:"value"`
+}
+
+type controlSocket struct {
+	listener   net.Listener
+	path       string
+	controller *controller
+}
+
+func RuntimeDir() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "wayland-recorder")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("wayland-recorder-%d", os.Getuid()))
+}
+
+func SocketPath(instance string) string {
+	return filepath.Join(RuntimeDir(), instance+".sock")
+}
+
+func socketRequest(instance string, command SocketCommand) (SocketResponse, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(instance), socketDialTimeout)
+	if err != nil {
+		return SocketResponse{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(socketRequestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(command); err != nil {
+		return SocketResponse{}, err
+	}
+	var response SocketResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return SocketResponse{}, err
+	}
+	if response.Error != "" {
+		return response, fmt.Errorf("%s", response.Error)
+	}
+	return response, nil
+}
+
+func startControlSocket(ctrl *controller, instance string) (*controlSocket, error) {
+	if listener, ok := activationListener(); ok {
+		socket := &controlSocket{listener: listener, controller: ctrl}
+		go socket.serve()
+		return socket, nil
+	}
+
+	path := SocketPath(instance)
+	if err := os.MkdirAll(filepath.Dir(path), runtimeDirPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	socket := &controlSocket{listener: listener, path: path, controller: ctrl}
+	go socket.serve()
+	return socket, nil
+}
+
+func removeStaleSocket(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("unix", path, socketDialTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use, is another recorder running?", path)
+	}
+	return os.Remove(path)
+}
+
+func (s *controlSocket) Close() {
+	s.listener.Close()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+func (s *controlSocket) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *controlSocket) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(conn)
+	write := func(value any) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		if err := encoder.Encode(value); err != nil {
+			conn.Close()
+		}
+	}
+
+	unsubscribe := func() {}
+	defer func() { unsubscribe() }()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var command SocketCommand
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			write(SocketResponse{Error: fmt.Sprintf("invalid command: %v", err)})
+			continue
+		}
+
+		if command.Command == actionSubscribe {
+			unsubscribe()
+			unsubscribe = s.subscribe(conn, write)
+			write(SocketResponse{OK: true})
+			continue
+		}
+
+		write(s.execute(command))
+	}
+}
+
+// Events are queued per client so a client that stops reading is dropped
+// instead of blocking the recorder.
+func (s *controlSocket) subscribe(conn net.Conn, write func(any)) func() {
+	events := make(chan SocketEvent, subscriberBacklog)
+	stop := make(chan struct{})
+
+	remove := s.controller.subscribe(func(event ControlEvent) {
+		select {
+		case events <- SocketEvent{Event: event.Name, Value: event.Value}:
+		default:
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				write(event)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			remove()
+			close(stop)
+		})
+	}
+}
+
+func (s *controlSocket) execute(command SocketCommand) SocketResponse {
+	switch command.Command {
+	case actionClip, actionStop, actionPause, actionResume, actionStatus, actionMarker:
+	default:
+		return SocketResponse{Error: fmt.Sprintf("unknown command: %s", command.Command)}
+	}
+
+	reply := s.controller.sendRequest(controlRequest{
+		action:   command.Command,
+		duration: time.Duration(command.Duration * float64(time.Second)),
+		postRoll: time.Duration(command.PostRoll * float64(time.Second)),
+		name:     command.Name,
+	})
+	if reply.err != nil {
+		return SocketResponse{Error: reply.err.Error()}
+	}
+
+	response := SocketResponse{OK: true, Path: reply.value}
+	switch command.Command {
+	case actionStatus:
+		response.Status = &reply.status
+	case actionMarker:
+		response.Marker = &reply.marker
+	}
+	return response
+}
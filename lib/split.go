@@ -0,0 +1,188 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const concatManifestHeader = "ffconcat version 1.0"
+
+var splitDirective = regexp.MustCompile(`%0?\d*d`)
+
+func ParseSplitEvery(s string) (time.Duration, int64, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, 0, nil
+	}
+
+	// Sizes need a B suffix so 500m (minutes) and 500M can't be mixed up.
+	if strings.HasSuffix(strings.ToUpper(s), "B") {
+		if size, err := ParseSize(s); err == nil && size > 0 {
+			return 0, size, nil
+		}
+	} else if duration, err := time.ParseDuration(s); err == nil && duration > 0 {
+		return duration, 0, nil
+	}
+	return 0, 0, fmt.Errorf("invalid split interval: %s (use a duration like 15m or 1h30m, or a size with a B suffix like 500MB or 2GB)", s)
+}
+
+func (opts CaptureOptions) Splitting() bool {
+	return !opts.ClipMode && (opts.SplitDuration > 0 || opts.SplitSize > 0)
+}
+
+func SplitLocation(outputPath string) string {
+	if splitDirective.MatchString(outputPath) {
+		return outputPath
+	}
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + "-%03d" + ext
+}
+
+func splitFiles(location string) []string {
+	matches, err := filepath.Glob(splitDirective.ReplaceAllString(location, "*"))
+	if err != nil {
+		return nil
+	}
+
+	var parts []string
+	for _, literal := range splitDirective.Split(location, -1) {
+		parts = append(parts, regexp.QuoteMeta(literal))
+	}
+	index := regexp.MustCompile("^" + strings.Join(parts, `\d+`) + "$")
+
+	var files []string
+	for _, match := range matches {
+		if index.MatchString(match) {
+			files = append(files, match)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+type splitTracker struct {
+	mu       sync.Mutex
+	location string
+	openedAt time.Time
+}
+
+func (st *splitTracker) handle(message gstMessage) {
+	if message.name() != fragmentOpenedMessage {
+		return
+	}
+	location, ok := message.field("location")
+	if !ok {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.location = location
+	st.openedAt = time.Now()
+}
+
+func (st *splitTracker) current() (string, time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.location, st.openedAt
+}
+
+func manifestPath(location string) string {
+	ext := filepath.Ext(location)
+	base := splitDirective.ReplaceAllString(strings.TrimSuffix(location, ext), "")
+	return strings.TrimRight(base, "-_.") + ".ffconcat"
+}
+
+func writeSplitManifest(location string) (string, error) {
+	files := splitFiles(location)
+	if len(files) == 0 {
+		return "", fmt.Errorf("no split files found")
+	}
+
+	path := manifestPath(location)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create manifest: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, concatManifestHeader)
+	for _, file := range files {
+		fmt.Fprintf(f, "file %s\n", concatQuote(filepath.Base(file)))
+	}
+	return path, nil
+}
+
+func ReadConcatManifest(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "file ") {
+			continue
+		}
+		file := concatUnquote(strings.TrimSpace(strings.TrimPrefix(line, "file ")))
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		files = append(files, file)
+	}
+	return files, scanner.Err()
+}
+
+func MergeManifest(manifest, outputPath string) error {
+	files, err := ReadConcatManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := ConcatFiles(files, outputPath); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d parts into: %s\n", len(files), outputPath)
+	return nil
+}
+
+func appendSplitOutput(args []string, opts CaptureOptions, audioPipeline []string) []string {
+	config, err := getMuxerConfig(opts.Container)
+	if err != nil {
+		return appendOutputSink(args, opts, "")
+	}
+
+	args = append(args, "!", "splitmuxsink", "name=mux",
+		fmt.Sprintf("muxer=%s", config.name),
+		fmt.Sprintf("location=%s", SplitLocation(opts.OutputPath)),
+		fmt.Sprintf("start-index=%d", opts.SegmentStartIndex))
+	if opts.SplitDuration > 0 {
+		args = append(args, fmt.Sprintf("max-size-time=%d", opts.SplitDuration.Nanoseconds()))
+	}
+	if opts.SplitSize > 0 {
+		args = append(args, fmt.Sprintf("max-size-bytes=%d", opts.SplitSize))
+	}
+
+	if len(audioPipeline) > 0 {
+		args = append(args, audioPipeline...)
+		args = append(args, "!", "mux.audio_0")
+	}
+	return args
+}
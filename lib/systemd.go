@@ -0,0 +1,266 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	daemonEnv          = "WAYLAND_RECORDER_DAEMON"
+	listenFdsStart     = 3
+	serviceFilePerms   = 0644
+	unitDirPermissions = 0755
+)
+
+type ServiceConfig struct {
+	Executable string
+	Instance   string
+	Args       []string
+	Socket     bool
+	DBus       bool
+}
+
+type ServiceFile struct {
+	Path    string
+	Content string
+}
+
+func RunningUnderSystemd() bool {
+	return os.Getenv("NOTIFY_SOCKET") != "" || os.Getenv("INVOCATION_ID") != ""
+}
+
+func Daemonized() bool {
+	return os.Getenv(daemonEnv) != "" || RunningUnderSystemd()
+}
+
+func withoutSystemdEnv(env []string) []string {
+	var filtered []string
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		switch name {
+		case "NOTIFY_SOCKET", "INVOCATION_ID", "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", daemonEnv:
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+func DefaultLogPath(instance string) string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		stateDir = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(stateDir, "wayland-recorder", instance+".log")
+}
+
+func Daemonize(logPath string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), defaultFilePermissions); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+	return pid, nil
+}
+
+func sdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(state))
+}
+
+func notifySystemd(event ControlEvent) {
+	if event.Name != EventStateChanged {
+		return
+	}
+
+	switch event.Value {
+	case StateRecording:
+		sdNotify("READY=1\nSTATUS=Recording")
+	case StatePaused:
+		sdNotify("STATUS=Paused")
+	case StateStopping:
+		sdNotify("STOPPING=1\nSTATUS=Finalizing recording")
+	}
+}
+
+func activationListener() (net.Listener, bool) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, false
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || count < 1 {
+		return nil, false
+	}
+
+	syscall.CloseOnExec(listenFdsStart)
+	listener, err := net.FileListener(os.NewFile(listenFdsStart, "control-socket"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring activation socket: %v\n", err)
+		return nil, false
+	}
+	return listener, true
+}
+
+func ServiceUnitName(instance string) string {
+	if instance == "" || instance == DefaultInstance {
+		return "wayland-recorder"
+	}
+	return "wayland-recorder-" + instance
+}
+
+func BuildServiceFiles(config ServiceConfig) ([]ServiceFile, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	unitName := ServiceUnitName(config.Instance)
+	unitDir := filepath.Join(configDir, "systemd", "user")
+
+	files := []ServiceFile{{
+		Path:    filepath.Join(unitDir, unitName+".service"),
+		Content: buildServiceUnit(config),
+	}}
+
+	if config.Socket {
+		files = append(files, ServiceFile{
+			Path:    filepath.Join(unitDir, unitName+".socket"),
+			Content: buildSocketUnit(config),
+		})
+	}
+
+	if config.DBus {
+		busName := BusName(config.Instance)
+		files = append(files, ServiceFile{
+			Path:    filepath.Join(homeDir, ".local", "share", "dbus-1", "services", busName+".service"),
+			Content: fmt.Sprintf("[D-BUS Service]\nName=%s\nExec=/bin/false\nSystemdService=%s.service\n", busName, unitName),
+		})
+	}
+
+	return files, nil
+}
+
+func buildServiceUnit(config ServiceConfig) string {
+	args := append([]string{config.Executable, "record", "--daemon", "--instance", config.Instance}, config.Args...)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteUnitArg(arg)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[Unit]\n")
+	fmt.Fprintf(&builder, "Description=Wayland screen recorder (%s)\n", config.Instance)
+	builder.WriteString("PartOf=graphical-session.target\n")
+	builder.WriteString("After=graphical-session.target\n")
+	if config.Socket {
+		fmt.Fprintf(&builder, "Requires=%s.socket\n", ServiceUnitName(config.Instance))
+	}
+	builder.WriteString("\n[Service]\n")
+	builder.WriteString("Type=notify\n")
+	fmt.Fprintf(&builder, "ExecStart=%s\n", strings.Join(quoted, " "))
+	builder.WriteString("Restart=on-failure\n")
+	fmt.Fprintf(&builder, "RestartPreventExitStatus=%d %d\n", exitCodeMaxDuration, exitCodeMaxSize)
+	builder.WriteString("RestartSec=5\n")
+	builder.WriteString("TimeoutStopSec=120\n")
+	builder.WriteString("\n[Install]\n")
+	builder.WriteString("WantedBy=graphical-session.target\n")
+	return builder.String()
+}
+
+func buildSocketUnit(config ServiceConfig) string {
+	var builder strings.Builder
+	builder.WriteString("[Unit]\n")
+	fmt.Fprintf(&builder, "Description=Wayland screen recorder control socket (%s)\n", config.Instance)
+	builder.WriteString("\n[Socket]\n")
+	fmt.Fprintf(&builder, "ListenStream=%%t/wayland-recorder/%s.sock\n", config.Instance)
+	builder.WriteString("SocketMode=0600\n")
+	builder.WriteString("DirectoryMode=0700\n")
+	builder.WriteString("\n[Install]\n")
+	builder.WriteString("WantedBy=sockets.target\n")
+	return builder.String()
+}
+
+func quoteUnitArg(arg string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+	if escaped == arg && arg != "" && !strings.ContainsAny(arg, " \t'") {
+		return arg
+	}
+	return `"` + escaped + `"`
+}
+
+func InstallServiceFiles(files []ServiceFile) error {
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.Path), unitDirPermissions); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(file.Path), err)
+		}
+		if err := os.WriteFile(file.Path, []byte(file.Content), serviceFilePerms); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+		fmt.Printf("Wrote %s\n", file.Path)
+	}
+	return nil
+}
+
+func EnableService(instance string, socket bool) error {
+	if err := exec.Command("systemctl", "--user", "daemon-reload").Run(); err != nil {
+		return fmt.Errorf("systemctl daemon-reload failed: %w", err)
+	}
+
+	units := []string{ServiceUnitName(instance) + ".service"}
+	if socket {
+		units = append(units, ServiceUnitName(instance)+".socket")
+	}
+
+	args := append([]string{"--user", "enable", "--now"}, units...)
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl enable failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRecordingTemplate = "recording-{date}-{time}"
+	DefaultClipTemplate      = "{base}-clip-{counter}"
+
+	maxTemplateCounter = 100000
+)
+
+var templatePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+type TemplateValues struct {
+	Time     time.Time
+	Counter  int
+	Instance string
+	Window   string
+	Profile  string
+	Name     string
+	Base     string
+	Duration time.Duration
+}
+
+func TemplatePlaceholders() []string {
+	return []string{"{date}", "{time}", "{counter}", "{instance}", "{window}", "{profile}", "{name}", "{base}", "{duration}"}
+}
+
+func ValidateTemplate(template string) error {
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := templateValue(match[1], TemplateValues{}); !ok {
+			return fmt.Errorf("unknown placeholder %s in %q (use: %s)", match[0], template, strings.Join(TemplatePlaceholders(), ", "))
+		}
+	}
+	return nil
+}
+
+func ExpandTemplate(template string, values TemplateValues) string {
+	if values.Time.IsZero() {
+		values.Time = time.Now()
+	}
+	return templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := templateValue(strings.Trim(placeholder, "{}"), values)
+		if !ok {
+			return placeholder
+		}
+		return sanitizeName(value)
+	})
+}
+
+func templateValue(name string, values TemplateValues) (string, bool) {
+	switch name {
+	case "date":
+		return values.Time.Format("2006-01-02"), true
+	case "time":
+		return values.Time.Format("15-04-05"), true
+	case "counter":
+		return fmt.Sprintf("%03d", values.Counter), true
+	case "instance":
+		return values.Instance, true
+	case "window":
+		return values.Window, true
+	case "profile":
+		return values.Profile, true
+	case "name":
+		return values.Name, true
+	case "base":
+		return values.Base, true
+	case "duration":
+		return values.Duration.Round(time.Second).String(), true
+	}
+	return "", false
+}
+
+func TemplatePath(dir, template, ext string, values *TemplateValues) string {
+	path := templatePath(dir, template, ext, values)
+	if err := os.MkdirAll(filepath.Dir(path), defaultFilePermissions); err != nil {
+		fmt.Printf("Warning: failed to create %s: %v\n", filepath.Dir(path), err)
+	}
+	return path
+}
+
+func templatePath(dir, template, ext string, values *TemplateValues) string {
+	counted := strings.Contains(template, "{counter}")
+	for ; counted && values.Counter < maxTemplateCounter; values.Counter++ {
+		path := filepath.Join(dir, ExpandTemplate(template, *values)+"."+ext)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+	return uniquePath(filepath.Join(dir, ExpandTemplate(template, *values)+"."+ext))
+}
+
+func UniquePath(path string) string {
+	return uniquePath(path)
+}
+
+func ActiveWindowTitle() string {
+	if output, err := exec.Command("hyprctl", "activewindow", "-j").Output(); err == nil {
+		var window struct {
+			Title string `json:"title"`
+		}
+		if json.Unmarshal(output, &window) == nil && window.Title != "" {
+			return window.Title
+		}
+	}
+
+	if output, err := exec.Command("swaymsg", "-t", "get_tree").Output(); err == nil {
+		var tree swayNode
+		if json.Unmarshal(output, &tree) == nil {
+			if title := tree.focusedTitle(); title != "" {
+				return title
+			}
+		}
+	}
+	return ""
+}
+
+type swayNode struct {
+	Name          string     `json:"name"`
+	Focused       bool       `json:"focused"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+func (n swayNode) focusedTitle() string {
+	if n.Focused {
+		return n.Name
+	}
+	for _, child := range append(n.Nodes, n.FloatingNodes...) {
+		if title := child.focusedTitle(); title != "" {
+			return title
+		}
+	}
+	return ""
+}
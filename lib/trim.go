@@ -0,0 +1,216 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minTrim = 100 * time.Millisecond
+
+func probeTiming(path string) (time.Duration, time.Duration, error) {
+	output, err := exec.Command(
+		"ffprobe",
+		"-v", "error",
+		"-show_entries", "format=start_time,duration",
+		"-of", "default=noprint_wrappers=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var pts, duration time.Duration
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "start_time":
+			pts = secondsToDuration(seconds)
+		case "duration":
+			duration = secondsToDuration(seconds)
+		}
+	}
+
+	if duration <= 0 {
+		return 0, 0, fmt.Errorf("no duration reported")
+	}
+	return pts, duration, nil
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func TrimSegments(segments []SegmentInfo, from, until time.Time, opts CaptureOptions, outputPath string) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("no segments to merge")
+	}
+
+	first, last := 0, len(segments)-1
+	headTrim := from.Sub(segments[first].StartTime)
+	tailEnd := until.Sub(segments[last].StartTime)
+	trimHead := headTrim > minTrim && segments[first].Duration > 0
+	trimTail := segments[last].Duration > 0 && segments[last].Duration-tailEnd > minTrim
+
+	if !trimHead && !trimTail {
+		return MergeSegments(segments, outputPath)
+	}
+
+	fmt.Printf("Creating clip from %d segments, trimming to %s...\n", len(segments), until.Sub(from).Round(time.Millisecond))
+
+	var temporary []string
+	defer func() {
+		for _, path := range temporary {
+			os.Remove(path)
+		}
+	}()
+
+	paths := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		var start, end time.Duration
+		if i == first && trimHead {
+			start = headTrim
+		}
+		if i == last && trimTail {
+			end = tailEnd
+		}
+		if start == 0 && end == 0 {
+			paths = append(paths, seg.Path)
+			continue
+		}
+
+		pieces, err := trimSegment(seg, start, end, opts)
+		temporary = append(temporary, pieces...)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, pieces...)
+	}
+
+	if err := ConcatFiles(paths, outputPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Clip saved to: %s\n", outputPath)
+	return nil
+}
+
+// Only the frames between the cut and the next keyframe are re-encoded, the
+// rest of the segment is copied as recorded.
+func trimSegment(seg SegmentInfo, start, end time.Duration, opts CaptureOptions) ([]string, error) {
+	var pieces []string
+	copyFrom := start
+	if start > 0 {
+		keyframe, ok := keyframeAfter(seg.Path, seg.PTS, start)
+		if !ok || (end > 0 && keyframe >= end) {
+			piece, err := trimRange(seg.Path, start, end, trimEncoderArgs(opts))
+			if err != nil {
+				return nil, err
+			}
+			return []string{piece}, nil
+		}
+		if keyframe > start {
+			piece, err := trimRange(seg.Path, start, keyframe, trimEncoderArgs(opts))
+			if err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, piece)
+		}
+		copyFrom = keyframe
+	}
+
+	piece, err := trimRange(seg.Path, copyFrom, end, []string{"-map", "0", "-c", "copy"})
+	if err != nil {
+		return pieces, err
+	}
+	return append(pieces, piece), nil
+}
+
+func keyframeAfter(path string, pts, offset time.Duration) (time.Duration, bool) {
+	output, err := exec.Command(
+		"ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		path,
+	).Output()
+	if err != nil {
+		return 0, false
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		value, flags, ok := strings.Cut(line, ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if keyframe := secondsToDuration(seconds) - pts; keyframe >= offset {
+			return keyframe, true
+		}
+	}
+	return 0, false
+}
+
+func trimRange(path string, start, end time.Duration, codecArgs []string) (string, error) {
+	output, err := os.CreateTemp(filepath.Dir(path), "trim-*"+filepath.Ext(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create trim file: %w", err)
+	}
+	output.Close()
+
+	args := []string{"-v", "error"}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start.Seconds(), 'f', 6, 64))
+	}
+	args = append(args, "-i", path)
+	if end > 0 {
+		args = append(args, "-t", strconv.FormatFloat((end-start).Seconds(), 'f', 6, 64))
+	}
+	args = append(args, codecArgs...)
+	args = append(args, "-y", output.Name())
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(output.Name())
+		return "", fmt.Errorf("failed to trim %s: %w", filepath.Base(path), err)
+	}
+	return output.Name(), nil
+}
+
+// Clip mode always records VP8 or VP9 video without audio.
+func trimEncoderArgs(opts CaptureOptions) []string {
+	var args []string
+	if opts.Codec == "vp8" {
+		args = append(args, "-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8")
+	} else {
+		args = append(args, "-c:v", "libvpx-vp9", "-deadline", "realtime", "-cpu-used", "8", "-row-mt", "1")
+	}
+	if opts.Quality > 0 {
+		args = append(args, "-b:v", strconv.Itoa(opts.Quality))
+	}
+	return args
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,384 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	ebmlSegmentID       = 0x18538067
+	ebmlInfoID          = 0x1549A966
+	ebmlTracksID        = 0x1654AE6B
+	ebmlClusterID       = 0x1F43B675
+	ebmlCuesID          = 0x1C53BB6B
+	ebmlTagsID          = 0x1254C367
+	ebmlSeekHeadID      = 0x114D9B74
+	ebmlChaptersID      = 0x1043A770
+	ebmlAttachmentsID   = 0x1941A469
+	ebmlTimecodeScaleID = 0x2AD7B1
+	ebmlTrackEntryID    = 0xAE
+	ebmlTrackNumberID   = 0xD7
+	ebmlTrackTypeID     = 0x83
+	ebmlTimecodeID      = 0xE7
+	ebmlSimpleBlockID   = 0xA3
+	ebmlBlockGroupID    = 0xA0
+	ebmlBlockID         = 0xA1
+	ebmlReferenceID     = 0xFB
+
+	ebmlUnknownSize     = -1
+	maxElementSize      = 64 << 20
+	maxClusterSize      = 256 << 20
+	matroskaVideoTrack  = 1
+	defaultTimecodeUnit = time.Millisecond
+)
+
+var ebmlTopLevelIDs = map[uint32]bool{
+	ebmlInfoID:        true,
+	ebmlTracksID:      true,
+	ebmlClusterID:     true,
+	ebmlCuesID:        true,
+	ebmlTagsID:        true,
+	ebmlSeekHeadID:    true,
+	ebmlChaptersID:    true,
+	ebmlAttachmentsID: true,
+}
+
+type webmCluster struct {
+	data     []byte
+	start    time.Duration
+	end      time.Duration
+	keyframe bool
+}
+
+type webmReader struct {
+	r          *bufio.Reader
+	pendingID  uint32
+	pendingRaw []byte
+	unit       time.Duration
+	videoTrack uint64
+	foundVideo bool
+}
+
+func newWebmReader(r io.Reader) *webmReader {
+	return &webmReader{r: bufio.NewReaderSize(r, 256*1024), unit: defaultTimecodeUnit}
+}
+
+func (wr *webmReader) readVint(marker bool) (uint64, []byte, error) {
+	first, err := wr.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, nil, fmt.Errorf("invalid EBML variable-length integer")
+	}
+
+	raw := make([]byte, length)
+	raw[0] = first
+	if _, err := io.ReadFull(wr.r, raw[1:]); err != nil {
+		return 0, nil, err
+	}
+
+	value := uint64(first)
+	if !marker {
+		value &= uint64(0xFF >> length)
+	}
+	for _, b := range raw[1:] {
+		value = value<<8 | uint64(b)
+	}
+	return value, raw, nil
+}
+
+func (wr *webmReader) readID() (uint32, []byte, error) {
+	if wr.pendingRaw != nil {
+		id, raw := wr.pendingID, wr.pendingRaw
+		wr.pendingRaw = nil
+		return id, raw, nil
+	}
+	id, raw, err := wr.readVint(true)
+	return uint32(id), raw, err
+}
+
+func (wr *webmReader) unreadID(id uint32, raw []byte) {
+	wr.pendingID, wr.pendingRaw = id, raw
+}
+
+func (wr *webmReader) readSize() (int64, []byte, error) {
+	size, raw, err := wr.readVint(false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if size == uint64(1)<<(7*len(raw))-1 {
+		return ebmlUnknownSize, raw, nil
+	}
+	return int64(size), raw, nil
+}
+
+func (wr *webmReader) readElement() (uint32, []byte, []byte, error) {
+	id, idRaw, err := wr.readID()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	size, sizeRaw, err := wr.readSize()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if size == ebmlUnknownSize {
+		return 0, nil, nil, fmt.Errorf("unexpected unknown-size element %#x", id)
+	}
+	if size > maxElementSize {
+		return 0, nil, nil, fmt.Errorf("element %#x is too large: %d bytes", id, size)
+	}
+
+	data := make([]byte, len(idRaw)+len(sizeRaw)+int(size))
+	n := copy(data, idRaw)
+	n += copy(data[n:], sizeRaw)
+	if _, err := io.ReadFull(wr.r, data[n:]); err != nil {
+		return 0, nil, nil, err
+	}
+	return id, data, data[n:], nil
+}
+
+func (wr *webmReader) readHeader() ([]byte, error) {
+	_, header, _, err := wr.readElement()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EBML header: %w", err)
+	}
+
+	id, idRaw, err := wr.readID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment: %w", err)
+	}
+	if id != ebmlSegmentID {
+		return nil, fmt.Errorf("expected segment, got element %#x", id)
+	}
+	if _, _, err := wr.readSize(); err != nil {
+		return nil, fmt.Errorf("failed to read segment size: %w", err)
+	}
+	header = append(header, idRaw...)
+	header = append(header, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	for {
+		id, raw, err := wr.readID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read segment header: %w", err)
+		}
+		if id == ebmlClusterID {
+			wr.unreadID(id, raw)
+			return header, nil
+		}
+
+		wr.unreadID(id, raw)
+		id, element, body, err := wr.readElement()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read segment header: %w", err)
+		}
+		switch id {
+		case ebmlInfoID:
+			wr.parseInfo(body)
+		case ebmlTracksID:
+			wr.parseTracks(body)
+		case ebmlSeekHeadID, ebmlCuesID:
+			continue
+		}
+		header = append(header, element...)
+	}
+}
+
+func (wr *webmReader) parseInfo(body []byte) {
+	forEachChild(body, func(id uint32, data []byte) {
+		if id == ebmlTimecodeScaleID {
+			if scale := readUint(data); scale > 0 {
+				wr.unit = time.Duration(scale)
+			}
+		}
+	})
+}
+
+func (wr *webmReader) parseTracks(body []byte) {
+	forEachChild(body, func(id uint32, entry []byte) {
+		if id != ebmlTrackEntryID || wr.foundVideo {
+			return
+		}
+		var number, kind uint64
+		forEachChild(entry, func(id uint32, data []byte) {
+			switch id {
+			case ebmlTrackNumberID:
+				number = readUint(data)
+			case ebmlTrackTypeID:
+				kind = readUint(data)
+			}
+		})
+		if kind == matroskaVideoTrack {
+			wr.videoTrack = number
+			wr.foundVideo = true
+		}
+	})
+}
+
+func (wr *webmReader) nextCluster() (webmCluster, error) {
+	for {
+		id, idRaw, err := wr.readID()
+		if err != nil {
+			return webmCluster{}, err
+		}
+		if id == ebmlClusterID {
+			return wr.readCluster(idRaw)
+		}
+
+		wr.unreadID(id, idRaw)
+		if _, _, _, err := wr.readElement(); err != nil {
+			return webmCluster{}, err
+		}
+	}
+}
+
+func (wr *webmReader) readCluster(idRaw []byte) (webmCluster, error) {
+	size, sizeRaw, err := wr.readSize()
+	if err != nil {
+		return webmCluster{}, err
+	}
+
+	cluster := webmCluster{data: append(append([]byte{}, idRaw...), sizeRaw...)}
+	var timecode, lastBlock int64
+	seenVideo := false
+	var read int64
+
+	for size == ebmlUnknownSize || read < size {
+		id, raw, err := wr.readID()
+		if err == io.EOF && size == ebmlUnknownSize {
+			break
+		}
+		if err != nil {
+			return webmCluster{}, err
+		}
+		if ebmlTopLevelIDs[id] {
+			wr.unreadID(id, raw)
+			break
+		}
+
+		wr.unreadID(id, raw)
+		id, element, body, err := wr.readElement()
+		if err != nil {
+			return webmCluster{}, err
+		}
+		cluster.data = append(cluster.data, element...)
+		read += int64(len(element))
+		if len(cluster.data) > maxClusterSize {
+			return webmCluster{}, fmt.Errorf("cluster is larger than %s", FormatSize(maxClusterSize))
+		}
+
+		var track uint64
+		var offset int64
+		var keyframe, ok bool
+		switch id {
+		case ebmlTimecodeID:
+			timecode = int64(readUint(body))
+		case ebmlSimpleBlockID:
+			track, offset, keyframe, ok = parseBlockHeader(body)
+		case ebmlBlockGroupID:
+			track, offset, keyframe, ok = parseBlockGroup(body)
+		}
+		if !ok {
+			continue
+		}
+		lastBlock = max(lastBlock, offset)
+		if !seenVideo && (!wr.foundVideo || track == wr.videoTrack) {
+			seenVideo = true
+			cluster.keyframe = keyframe
+		}
+	}
+
+	cluster.start = time.Duration(timecode) * wr.unit
+	cluster.end = time.Duration(timecode+lastBlock) * wr.unit
+	return cluster, nil
+}
+
+func parseBlockHeader(body []byte) (uint64, int64, bool, bool) {
+	track, length := decodeVint(body)
+	if length == 0 || len(body) < length+3 {
+		return 0, 0, false, false
+	}
+	offset := int64(int16(uint16(body[length])<<8 | uint16(body[length+1])))
+	keyframe := body[length+2]&0x80 != 0
+	return track, offset, keyframe, true
+}
+
+func parseBlockGroup(body []byte) (uint64, int64, bool, bool) {
+	var track uint64
+	var offset int64
+	found, referenced := false, false
+	forEachChild(body, func(id uint32, data []byte) {
+		switch id {
+		case ebmlBlockID:
+			track, offset, _, found = parseBlockHeader(data)
+		case ebmlReferenceID:
+			referenced = true
+		}
+	})
+	return track, offset, !referenced, found
+}
+
+func forEachChild(body []byte, visit func(id uint32, data []byte)) {
+	for len(body) > 0 {
+		idLength := vintLength(body[0])
+		if idLength == 0 || idLength > len(body) {
+			return
+		}
+		id := uint32(0)
+		for _, b := range body[:idLength] {
+			id = id<<8 | uint32(b)
+		}
+		body = body[idLength:]
+
+		size, sizeLength := decodeVint(body)
+		if sizeLength == 0 || uint64(len(body)-sizeLength) < size {
+			return
+		}
+		body = body[sizeLength:]
+		visit(id, body[:size])
+		body = body[size:]
+	}
+}
+
+func vintLength(first byte) int {
+	for length := 1; length <= 8; length++ {
+		if first&(0x80>>(length-1)) != 0 {
+			return length
+		}
+	}
+	return 0
+}
+
+func decodeVint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	length := vintLength(data[0])
+	if length == 0 || length > len(data) {
+		return 0, 0
+	}
+	value := uint64(data[0]) & uint64(0xFF>>length)
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
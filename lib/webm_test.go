@@ -0,0 +1,259 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package lib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+const (
+	testAudioTrack = 1
+	testVideoTrack = 2
+)
+
+func ebmlID(id uint32) []byte {
+	var raw []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(raw) > 0 {
+			raw = append(raw, b)
+		}
+	}
+	return raw
+}
+
+func ebmlElement(id uint32, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	element := ebmlID(id)
+	if len(body) < 0x7F {
+		element = append(element, 0x80|byte(len(body)))
+	} else {
+		size := uint64(len(body))
+		element = append(element, 0x01)
+		for shift := 48; shift >= 0; shift -= 8 {
+			element = append(element, byte(size>>shift))
+		}
+	}
+	return append(element, body...)
+}
+
+func ebmlUnknownElement(id uint32, children ...[]byte) []byte {
+	element := append(ebmlID(id), 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	return append(element, bytes.Join(children, nil)...)
+}
+
+func ebmlUintElement(id uint32, value uint64) []byte {
+	var body []byte
+	for shift := 56; shift >= 0; shift -= 8 {
+		if b := byte(value >> shift); b != 0 || len(body) > 0 || shift == 0 {
+			body = append(body, b)
+		}
+	}
+	return ebmlElement(id, body)
+}
+
+func blockHeader(track uint64, offset int16, flags byte) []byte {
+	return []byte{0x80 | byte(track), byte(uint16(offset) >> 8), byte(offset), flags, 0xAB, 0xCD}
+}
+
+func simpleBlock(track uint64, offset int16, keyframe bool) []byte {
+	var flags byte
+	if keyframe {
+		flags = 0x80
+	}
+	return ebmlElement(ebmlSimpleBlockID, blockHeader(track, offset, flags))
+}
+
+func blockGroup(track uint64, offset int16, referenced bool) []byte {
+	children := [][]byte{ebmlElement(ebmlBlockID, blockHeader(track, offset, 0))}
+	if referenced {
+		children = append(children, ebmlElement(ebmlReferenceID, []byte{0xDF}))
+	}
+	return ebmlElement(ebmlBlockGroupID, children...)
+}
+
+func trackEntry(number, kind uint64) []byte {
+	return ebmlElement(ebmlTrackEntryID, ebmlUintElement(ebmlTrackNumberID, number), ebmlUintElement(ebmlTrackTypeID, kind))
+}
+
+// matroskaStream lays out a stream the way matroskamux streamable=true
+// writes it: unknown-size Segment, SeekHead, Info and Tracks, then clusters.
+func matroskaStream(timecodeScale uint64, clusters ...[]byte) []byte {
+	info := []byte{}
+	if timecodeScale > 0 {
+		info = ebmlUintElement(ebmlTimecodeScaleID, timecodeScale)
+	}
+	return append(ebmlElement(0x1A45DFA3, ebmlElement(0x4282, []byte("webm"))),
+		ebmlUnknownElement(ebmlSegmentID,
+			ebmlElement(ebmlSeekHeadID, ebmlElement(0x4DBB, ebmlUintElement(0x53AC, 1))),
+			ebmlElement(ebmlInfoID, info),
+			ebmlElement(ebmlTracksID, trackEntry(testAudioTrack, 2), trackEntry(testVideoTrack, 1)),
+			bytes.Join(clusters, nil),
+		)...)
+}
+
+func TestWebmReaderClusters(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream []byte
+		want   []webmCluster
+	}{
+		{
+			name: "unknown-size clusters",
+			stream: matroskaStream(0,
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 0),
+					simpleBlock(testVideoTrack, 0, true),
+					simpleBlock(testVideoTrack, 33, false)),
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 66),
+					simpleBlock(testVideoTrack, 0, false),
+					simpleBlock(testVideoTrack, 33, false)),
+			),
+			want: []webmCluster{
+				{start: 0, end: 33 * time.Millisecond, keyframe: true},
+				{start: 66 * time.Millisecond, end: 99 * time.Millisecond, keyframe: false},
+			},
+		},
+		{
+			name: "known-size cluster followed by cues",
+			stream: matroskaStream(0,
+				ebmlElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 1000),
+					simpleBlock(testVideoTrack, 0, true)),
+				ebmlElement(ebmlCuesID, ebmlElement(0xBB)),
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 2000),
+					simpleBlock(testVideoTrack, 0, true)),
+			),
+			want: []webmCluster{
+				{start: time.Second, end: time.Second, keyframe: true},
+				{start: 2 * time.Second, end: 2 * time.Second, keyframe: true},
+			},
+		},
+		{
+			name: "block groups",
+			stream: matroskaStream(0,
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 0),
+					blockGroup(testVideoTrack, 0, false),
+					blockGroup(testVideoTrack, 40, true)),
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 80),
+					blockGroup(testVideoTrack, 0, true)),
+			),
+			want: []webmCluster{
+				{start: 0, end: 40 * time.Millisecond, keyframe: true},
+				{start: 80 * time.Millisecond, end: 80 * time.Millisecond, keyframe: false},
+			},
+		},
+		{
+			name: "audio block before video",
+			stream: matroskaStream(0,
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 0),
+					simpleBlock(testAudioTrack, 0, true),
+					simpleBlock(testVideoTrack, 10, false),
+					simpleBlock(testAudioTrack, 20, true)),
+			),
+			want: []webmCluster{
+				{start: 0, end: 20 * time.Millisecond, keyframe: false},
+			},
+		},
+		{
+			name: "timecode scale",
+			stream: matroskaStream(100000,
+				ebmlUnknownElement(ebmlClusterID,
+					ebmlUintElement(ebmlTimecodeID, 30),
+					simpleBlock(testVideoTrack, 0, true),
+					simpleBlock(testVideoTrack, 5, false)),
+			),
+			want: []webmCluster{
+				{start: 3 * time.Millisecond, end: 3500 * time.Microsecond, keyframe: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := newWebmReader(bytes.NewReader(test.stream))
+			header, err := reader.readHeader()
+			if err != nil {
+				t.Fatalf("readHeader: %v", err)
+			}
+
+			var got []webmCluster
+			for {
+				cluster, err := reader.nextCluster()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("nextCluster: %v", err)
+				}
+				got = append(got, cluster)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d clusters, want %d", len(got), len(test.want))
+			}
+			for i, cluster := range got {
+				want := test.want[i]
+				if cluster.start != want.start || cluster.end != want.end || cluster.keyframe != want.keyframe {
+					t.Errorf("cluster %d: got start=%s end=%s keyframe=%v, want start=%s end=%s keyframe=%v",
+						i, cluster.start, cluster.end, cluster.keyframe, want.start, want.end, want.keyframe)
+				}
+				if !bytes.HasPrefix(cluster.data, ebmlID(ebmlClusterID)) {
+					t.Errorf("cluster %d does not start with a Cluster element", i)
+				}
+			}
+
+			exported := append(append([]byte{}, header...), got[len(got)-1].data...)
+			reread := newWebmReader(bytes.NewReader(exported))
+			if _, err := reread.readHeader(); err != nil {
+				t.Fatalf("exported header: %v", err)
+			}
+			cluster, err := reread.nextCluster()
+			if err != nil || !bytes.Equal(cluster.data, got[len(got)-1].data) {
+				t.Errorf("exported cluster did not read back: %v", err)
+			}
+		})
+	}
+}
+
+func TestWebmReaderHeader(t *testing.T) {
+	reader := newWebmReader(bytes.NewReader(matroskaStream(0,
+		ebmlUnknownElement(ebmlClusterID, ebmlUintElement(ebmlTimecodeID, 0), simpleBlock(testVideoTrack, 0, true)))))
+	header, err := reader.readHeader()
+	if err != nil {
+		t.Fatalf("readHeader: %v", err)
+	}
+
+	segment := append(ebmlID(ebmlSegmentID), 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	if !bytes.Contains(header, segment) {
+		t.Error("segment size was not rewritten to unknown")
+	}
+	if bytes.Contains(header, ebmlID(ebmlSeekHeadID)) {
+		t.Error("SeekHead was copied into the header")
+	}
+	if reader.videoTrack != testVideoTrack {
+		t.Errorf("video track = %d, want %d", reader.videoTrack, testVideoTrack)
+	}
+}
+
+func TestWebmReaderRejectsOversizedElements(t *testing.T) {
+	block := append(ebmlID(ebmlSimpleBlockID), 0x01, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00)
+	stream := matroskaStream(0, ebmlUnknownElement(ebmlClusterID, ebmlUintElement(ebmlTimecodeID, 0), block))
+
+	reader := newWebmReader(bytes.NewReader(stream))
+	if _, err := reader.readHeader(); err != nil {
+		t.Fatalf("readHeader: %v", err)
+	}
+	if _, err := reader.nextCluster(); err == nil || err == io.EOF {
+		t.Fatalf("nextCluster accepted a %d byte element: %v", 1<<36, err)
+	}
+}